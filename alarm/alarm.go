@@ -0,0 +1,86 @@
+package alarm
+
+import (
+	"strings"
+	"time"
+
+	"github.com/zoneBen/ProtoHub/modu"
+)
+
+const (
+	SourcePoll = "poll"
+	SourceTrap = "trap"
+)
+
+// Compare 按操作符比较数值，未知操作符返回 false
+func Compare(operator string, v, threshold float64) bool {
+	switch strings.TrimSpace(operator) {
+	case ">":
+		return v > threshold
+	case ">=":
+		return v >= threshold
+	case "<":
+		return v < threshold
+	case "<=":
+		return v <= threshold
+	case "=", "==":
+		return v == threshold
+	case "!=", "<>":
+		return v != threshold
+	}
+	return false
+}
+
+// notZeroEnabled 判断 EAddr.NotZeroAlarm 是否开启
+func notZeroEnabled(s string) bool {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "0", "否", "n", "no", "false":
+		return false
+	}
+	return true
+}
+
+// valid 测点值是否可用于告警判断，采集或解码失败的测点值为 0，不能参与比较
+func valid(v modu.ParseValue) bool {
+	return v.Quality == modu.QualityGood || v.Quality == modu.QualityOutOfRange
+}
+
+// Check 根据 EAlarm 规则与测点的非零告警设定检查一次轮询结果，质量异常的测点不参与判断
+func Check(dev *modu.EParser, values map[string]modu.ParseValue) []modu.AlarmEvent {
+	var events []modu.AlarmEvent
+	now := time.Now()
+	for _, v := range values {
+		if !valid(v) || !notZeroEnabled(v.Addr.NotZeroAlarm) || v.Value == 0 {
+			continue
+		}
+		events = append(events, modu.AlarmEvent{
+			Device:     dev.Dev.Name,
+			MetricName: v.Addr.MetricName,
+			MetricCode: v.Addr.MetricCode,
+			Value:      v.Value,
+			AlarmCont:  v.Addr.AlarmCont,
+			Source:     SourcePoll,
+			Time:       now,
+		})
+	}
+	for _, rule := range dev.Alarms {
+		for _, v := range values {
+			if !valid(v) || v.Addr.MetricName != rule.MetricName && v.Addr.MetricCode != rule.MetricName {
+				continue
+			}
+			if !Compare(rule.Operator, v.Value, rule.Value) {
+				continue
+			}
+			events = append(events, modu.AlarmEvent{
+				Device:     dev.Dev.Name,
+				MetricName: v.Addr.MetricName,
+				MetricCode: v.Addr.MetricCode,
+				Value:      v.Value,
+				AlarmCont:  rule.AlarmCont,
+				Source:     SourcePoll,
+				Time:       now,
+			})
+		}
+	}
+	return events
+}
@@ -0,0 +1,191 @@
+// Package checksum 协议常用的校验算法，按名称选择，并可按帧的声明追加与校验。
+package checksum
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Checksum 校验算法
+type Checksum interface {
+	Name() string
+	Size() int              // 校验值字节数
+	Sum(data []byte) uint64 // 计算校验值
+	LittleEndian() bool     // 惯用的传输字节序
+}
+
+// 算法名称
+const (
+	YDT1363     = "YDT1363"      // 电总：ASCII 字符累加和取反加 1，16 位
+	CRC16Modbus = "CRC16-MODBUS" // 多项式 0x8005 反射，初值 0xFFFF，低字节在前
+	CRC16CCITT  = "CRC16-CCITT"  // 多项式 0x1021，初值 0xFFFF（CCITT-FALSE）
+	CRC16XModem = "CRC16-XMODEM" // 多项式 0x1021，初值 0
+	CRC8        = "CRC8"         // 多项式 0x07，初值 0
+	CRC8Maxim   = "CRC8-MAXIM"   // 多项式 0x31 反射，初值 0（DS18B20 等）
+	LRC         = "LRC"          // 字节累加和取反加 1，8 位（Modbus ASCII）
+	XOR         = "XOR"          // 字节异或
+	SUM8        = "SUM8"         // 字节累加和模 256（DL/T 645、CJ/T 188）
+	SUM16       = "SUM16"        // 字节累加和模 65536
+)
+
+type algorithm struct {
+	name   string
+	size   int
+	little bool
+	sum    func([]byte) uint64
+}
+
+func (a *algorithm) Name() string           { return a.name }
+func (a *algorithm) Size() int              { return a.size }
+func (a *algorithm) Sum(data []byte) uint64 { return a.sum(data) }
+func (a *algorithm) LittleEndian() bool     { return a.little }
+
+var algorithms = map[string]*algorithm{}
+
+// 别名，均为大写
+var aliases = map[string]string{
+	"电总":      YDT1363,
+	"YDT":     YDT1363,
+	"MODBUS":  CRC16Modbus,
+	"CRC16":   CRC16Modbus,
+	"CCITT":   CRC16CCITT,
+	"XMODEM":  CRC16XModem,
+	"MAXIM":   CRC8Maxim,
+	"SUM":     SUM8,
+	"645":     SUM8,
+	"188":     SUM8,
+	"CRC-8":   CRC8,
+	"CRC8-07": CRC8,
+}
+
+func register(name string, size int, little bool, sum func([]byte) uint64) {
+	algorithms[name] = &algorithm{name: name, size: size, little: little, sum: sum}
+}
+
+func init() {
+	register(YDT1363, 2, false, func(data []byte) uint64 {
+		var sum uint16
+		for _, b := range data {
+			sum += uint16(b)
+		}
+		return uint64(^sum + 1)
+	})
+	register(CRC16Modbus, 2, true, func(data []byte) uint64 {
+		return uint64(crc16Reflected(data, 0xA001, 0xFFFF))
+	})
+	register(CRC16CCITT, 2, false, func(data []byte) uint64 {
+		return uint64(crc16(data, 0x1021, 0xFFFF))
+	})
+	register(CRC16XModem, 2, false, func(data []byte) uint64 {
+		return uint64(crc16(data, 0x1021, 0))
+	})
+	register(CRC8, 1, false, func(data []byte) uint64 {
+		var crc byte
+		for _, b := range data {
+			crc ^= b
+			for i := 0; i < 8; i++ {
+				if crc&0x80 != 0 {
+					crc = crc<<1 ^ 0x07
+				} else {
+					crc <<= 1
+				}
+			}
+		}
+		return uint64(crc)
+	})
+	register(CRC8Maxim, 1, false, func(data []byte) uint64 {
+		var crc byte
+		for _, b := range data {
+			crc ^= b
+			for i := 0; i < 8; i++ {
+				if crc&0x01 != 0 {
+					crc = crc>>1 ^ 0x8C
+				} else {
+					crc >>= 1
+				}
+			}
+		}
+		return uint64(crc)
+	})
+	register(LRC, 1, false, func(data []byte) uint64 {
+		var sum byte
+		for _, b := range data {
+			sum += b
+		}
+		return uint64(^sum + 1)
+	})
+	register(XOR, 1, false, func(data []byte) uint64 {
+		var x byte
+		for _, b := range data {
+			x ^= b
+		}
+		return uint64(x)
+	})
+	register(SUM8, 1, false, func(data []byte) uint64 {
+		var sum byte
+		for _, b := range data {
+			sum += b
+		}
+		return uint64(sum)
+	})
+	register(SUM16, 2, false, func(data []byte) uint64 {
+		var sum uint16
+		for _, b := range data {
+			sum += uint16(b)
+		}
+		return uint64(sum)
+	})
+}
+
+func crc16(data []byte, poly, init uint16) uint16 {
+	crc := init
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ poly
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+func crc16Reflected(data []byte, poly, init uint16) uint16 {
+	crc := init
+	for _, b := range data {
+		crc ^= uint16(b)
+		for i := 0; i < 8; i++ {
+			if crc&0x0001 != 0 {
+				crc = crc>>1 ^ poly
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return crc
+}
+
+// Get 按名称或别名查找算法，不区分大小写
+func Get(name string) (Checksum, error) {
+	key := strings.ToUpper(strings.TrimSpace(name))
+	if alias, ok := aliases[key]; ok {
+		key = alias
+	}
+	if a, ok := algorithms[key]; ok {
+		return a, nil
+	}
+	return nil, fmt.Errorf("不支持的校验算法: %s", name)
+}
+
+// Names 所有算法名称
+func Names() []string {
+	names := make([]string, 0, len(algorithms))
+	for name := range algorithms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,141 @@
+package checksum
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCheckValues(t *testing.T) {
+	tests := []struct {
+		name string
+		want uint64
+	}{
+		{CRC16Modbus, 0x4B37},
+		{CRC16CCITT, 0x29B1},
+		{CRC16XModem, 0x31C3},
+		{CRC8, 0xF4},
+		{CRC8Maxim, 0xA1},
+		{LRC, 0x23},
+		{XOR, 0x31},
+		{SUM8, 0xDD},
+		{SUM16, 0x01DD},
+		{YDT1363, 0xFE23},
+	}
+	for _, tt := range tests {
+		alg, err := Get(tt.name)
+		if err != nil {
+			t.Fatalf("Get(%q): %v", tt.name, err)
+		}
+		if got := alg.Sum([]byte("123456789")); got != tt.want {
+			t.Errorf("%s(\"123456789\") = %04X, want %04X", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGet(t *testing.T) {
+	if _, err := Get(" crc16-modbus "); err != nil {
+		t.Errorf("Get 应不区分大小写: %v", err)
+	}
+	if _, err := Get("CRC32"); err == nil {
+		t.Error("Get(\"CRC32\") 应返回错误")
+	}
+	if len(Names()) == 0 {
+		t.Error("Names() 为空")
+	}
+}
+
+func TestSpecAppendVerify(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    Spec
+		trailer []byte
+		body    []byte
+		want    []byte // 追加的校验值
+	}{
+		{"modbus natural", Spec{Algorithm: mustGet(CRC16Modbus)}, nil,
+			[]byte{0x01, 0x03, 0x00, 0x00, 0x00, 0x01}, []byte{0x84, 0x0A}},
+		{"modbus LE", Spec{Algorithm: mustGet(CRC16Modbus), Order: OrderLE}, nil,
+			[]byte{0x01, 0x03, 0x00, 0x00, 0x00, 0x01}, []byte{0x84, 0x0A}},
+		{"modbus BE", Spec{Algorithm: mustGet(CRC16Modbus), Order: OrderBE}, nil,
+			[]byte{0x01, 0x03, 0x00, 0x00, 0x00, 0x01}, []byte{0x0A, 0x84}},
+		{"modbus HEX", Spec{Algorithm: mustGet(CRC16Modbus), Order: OrderHex}, nil,
+			[]byte{0x01, 0x03, 0x00, 0x00, 0x00, 0x01}, []byte("0A84")},
+		{"ydt1363", Spec{Algorithm: mustGet(YDT1363), Start: 1, Order: OrderHex}, []byte("\r"),
+			[]byte("~20014000A006010203"), []byte("FC7C")},
+		{"negative end", Spec{Algorithm: mustGet(SUM8), Start: 1, End: -1}, nil,
+			[]byte{0x68, 0x01, 0x02, 0x03, 0xFF}, []byte{0x06}},
+		{"negative start", Spec{Algorithm: mustGet(SUM8), Start: -2}, nil,
+			[]byte{0x01, 0x02, 0x03, 0x04}, []byte{0x07}},
+		{"width BE", Spec{Algorithm: mustGet(SUM8), Width: 2, Order: OrderBE}, nil,
+			[]byte{0x01, 0x02, 0x03}, []byte{0x00, 0x06}},
+		{"width LE", Spec{Algorithm: mustGet(SUM8), Width: 2, Order: OrderLE}, nil,
+			[]byte{0x01, 0x02, 0x03}, []byte{0x06, 0x00}},
+	}
+	for _, tt := range tests {
+		frame, err := tt.spec.Append(append([]byte(nil), tt.body...))
+		if err != nil {
+			t.Errorf("%s: Append: %v", tt.name, err)
+			continue
+		}
+		if got := frame[len(tt.body):]; !bytes.Equal(got, tt.want) {
+			t.Errorf("%s: Append 校验值 = %X, want %X", tt.name, got, tt.want)
+		}
+		frame = append(frame, tt.trailer...)
+		body, err := tt.spec.Verify(frame, len(tt.trailer))
+		if err != nil {
+			t.Errorf("%s: Verify: %v", tt.name, err)
+			continue
+		}
+		if !bytes.Equal(body, tt.body) {
+			t.Errorf("%s: Verify 返回 %X, want %X", tt.name, body, tt.body)
+		}
+		frame[len(tt.body)] ^= 0x01
+		if _, err := tt.spec.Verify(frame, len(tt.trailer)); err == nil {
+			t.Errorf("%s: 校验值错误时 Verify 应返回错误", tt.name)
+		}
+	}
+}
+
+func TestSpecErrors(t *testing.T) {
+	spec := Spec{Algorithm: mustGet(CRC16Modbus)}
+	if _, err := spec.Verify([]byte{0x01}, 0); err == nil {
+		t.Error("帧长度不足时 Verify 应返回错误")
+	}
+	spec = Spec{Algorithm: mustGet(SUM8), Start: 5}
+	if _, err := spec.Compute([]byte{0x01, 0x02, 0x03}); err == nil {
+		t.Error("范围超出帧长度时 Compute 应返回错误")
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		in         string
+		start, end int
+		ok         bool
+	}{
+		{"", 0, 0, true},
+		{"1..", 1, 0, true},
+		{"1..-2", 1, -2, true},
+		{"..-1", 0, -1, true},
+		{"1", 0, 0, false},
+		{"a..b", 0, 0, false},
+	}
+	for _, tt := range tests {
+		start, end, err := ParseRange(tt.in)
+		if (err == nil) != tt.ok {
+			t.Errorf("ParseRange(%q) err = %v", tt.in, err)
+			continue
+		}
+		if tt.ok && (start != tt.start || end != tt.end) {
+			t.Errorf("ParseRange(%q) = %d, %d, want %d, %d", tt.in, start, end, tt.start, tt.end)
+		}
+	}
+}
+
+func mustGet(name string) Checksum {
+	alg, err := Get(name)
+	if err != nil {
+		panic(err)
+	}
+	return alg
+}
@@ -0,0 +1,168 @@
+package checksum
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/zoneBen/ProtoHub/modu"
+)
+
+// 校验值在帧中的表示
+const (
+	OrderLE  = "LE"  // 二进制，低字节在前
+	OrderBE  = "BE"  // 二进制，高字节在前
+	OrderHex = "HEX" // 大写十六进制文本，高位在前（电总、Modbus ASCII 等）
+)
+
+// Spec 帧校验声明：对校验值之前的帧内容 [Start, End) 计算，校验值以 Order 表示、占 Width 字节。
+// Start、End 为负数时从校验值前的帧尾倒数，End 为 0 表示到校验值之前，
+// 如 Start=1、End=0 表示跳过帧头 1 字节，覆盖其后直到校验值的全部字节。
+type Spec struct {
+	Algorithm Checksum
+	Start     int
+	End       int
+	Width     int    // 校验值的二进制字节数，0 为算法长度，超出时高位补零
+	Order     string // 为空时按算法惯用字节序
+}
+
+// New 按名称创建覆盖全部内容的声明
+func New(name string) (*Spec, error) {
+	alg, err := Get(name)
+	if err != nil {
+		return nil, err
+	}
+	return &Spec{Algorithm: alg}, nil
+}
+
+// FromDev 按设备配置创建声明，未配置 Checksum 时返回 nil
+func FromDev(dev modu.EDev) (*Spec, error) {
+	if dev.Checksum == "" {
+		return nil, nil
+	}
+	s, err := New(dev.Checksum)
+	if err != nil {
+		return nil, err
+	}
+	if s.Start, s.End, err = ParseRange(dev.ChecksumRange); err != nil {
+		return nil, err
+	}
+	s.Width = dev.CrcNum
+	s.Order = strings.ToUpper(dev.ChecksumOrder)
+	switch s.Order {
+	case "", OrderLE, OrderBE, OrderHex:
+	default:
+		return nil, fmt.Errorf("不支持的校验字节序: %s", dev.ChecksumOrder)
+	}
+	return s, nil
+}
+
+// ParseRange 解析 "起始..结束" 形式的计算范围，如 "1.."、"1..-2"，为空时覆盖全部
+func ParseRange(s string) (start, end int, err error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, 0, nil
+	}
+	parts := strings.SplitN(s, "..", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("校验范围%q格式错误，应为 起始..结束", s)
+	}
+	if p := strings.TrimSpace(parts[0]); p != "" {
+		if start, err = strconv.Atoi(p); err != nil {
+			return 0, 0, fmt.Errorf("校验范围%q起始无效", s)
+		}
+	}
+	if p := strings.TrimSpace(parts[1]); p != "" {
+		if end, err = strconv.Atoi(p); err != nil {
+			return 0, 0, fmt.Errorf("校验范围%q结束无效", s)
+		}
+	}
+	return start, end, nil
+}
+
+// width 校验值的二进制字节数
+func (s *Spec) width() int {
+	if s.Width > 0 {
+		return s.Width
+	}
+	return s.Algorithm.Size()
+}
+
+// Len 校验值在帧中占用的字节数
+func (s *Spec) Len() int {
+	if s.Order == OrderHex {
+		return s.width() * 2
+	}
+	return s.width()
+}
+
+// Encode 将校验值按声明编码
+func (s *Spec) Encode(sum uint64) []byte {
+	w := s.width()
+	out := make([]byte, w)
+	for i := w - 1; i >= 0; i-- {
+		out[i] = byte(sum)
+		sum >>= 8
+	}
+	switch s.Order {
+	case OrderHex:
+		return []byte(strings.ToUpper(hex.EncodeToString(out)))
+	case OrderLE:
+	case OrderBE:
+		return out
+	default:
+		if !s.Algorithm.LittleEndian() {
+			return out
+		}
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out
+}
+
+// Compute 计算 body（校验值之前的帧内容）的校验值并编码
+func (s *Spec) Compute(body []byte) ([]byte, error) {
+	start, end := s.Start, s.End
+	if start < 0 {
+		start += len(body)
+	}
+	if end <= 0 {
+		end += len(body)
+	}
+	if start < 0 || end > len(body) || start > end {
+		return nil, fmt.Errorf("校验范围[%d,%d)超出帧长度%d", s.Start, s.End, len(body))
+	}
+	return s.Encode(s.Algorithm.Sum(body[start:end])), nil
+}
+
+// Append 在帧后追加校验值
+func (s *Spec) Append(frame []byte) ([]byte, error) {
+	sum, err := s.Compute(frame)
+	if err != nil {
+		return nil, err
+	}
+	return append(frame, sum...), nil
+}
+
+// Verify 校验帧，trailer 为校验值之后的帧尾字节数（如 EOI），返回校验值之前的内容
+func (s *Spec) Verify(frame []byte, trailer int) ([]byte, error) {
+	n := len(frame) - trailer - s.Len()
+	if n < 0 || trailer < 0 {
+		return nil, fmt.Errorf("帧长度%d不足以包含%s校验", len(frame), s.Algorithm.Name())
+	}
+	body, got := frame[:n], frame[n:n+s.Len()]
+	want, err := s.Compute(body)
+	if err != nil {
+		return nil, err
+	}
+	if s.Order == OrderHex {
+		got = bytes.ToUpper(got)
+	}
+	if !bytes.Equal(got, want) {
+		return nil, fmt.Errorf("%s校验错误: 收到%X，计算为%X", s.Algorithm.Name(), got, want)
+	}
+	return body, nil
+}
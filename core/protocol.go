@@ -9,3 +9,8 @@ type Protocol interface {
 	Send(transport Transport, sendBuf []byte, dev *modu.EParser) ([]byte, error)
 	ParseResponse(data []byte, dev *modu.EParser, addrs []modu.EAddr) (map[string]modu.ParseValue, error)
 }
+
+// Writer 支持写屏设定（EHmi）的协议，value 为工程值
+type Writer interface {
+	WriteHmi(transport Transport, dev *modu.EParser, hmi modu.EHmi, value float64) error
+}
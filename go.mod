@@ -2,7 +2,10 @@ module github.com/zoneBen/ProtoHub
 
 go 1.17
 
-require github.com/albenik/go-serial/v2 v2.6.1
+require (
+	github.com/albenik/go-serial/v2 v2.6.1
+	golang.org/x/text v0.14.0
+)
 
 require (
 	github.com/creack/goselect v0.1.2 // indirect
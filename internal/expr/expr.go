@@ -0,0 +1,585 @@
+// Package expr 测点公式的表达式引擎，只做数值计算，不执行任意代码。
+//
+// 语法接近 Python：
+//
+//	算术      + - * / // % **
+//	位运算    & | ^ ~ << >>（按 int64 计算）
+//	比较      < <= > >= == !=，结果为 1 或 0
+//	逻辑      and or not
+//	条件      a if cond else b
+//	函数      abs min max round floor ceil sqrt pow int
+//
+// 数字支持十进制、0x 十六进制与 0b 二进制。变量为标识符，
+// 以数字开头或含特殊字符的名称写在方括号中，如 [41_output_voltage]。
+package expr
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Resolver 按名称取变量值，不存在时返回 false
+type Resolver func(name string) (float64, bool)
+
+// Expr 编译后的表达式
+type Expr struct {
+	src  string
+	root node
+	vars []string
+}
+
+// Compile 编译表达式
+func Compile(src string) (*Expr, error) {
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{tokens: tokens, vars: make(map[string]bool)}
+	root, err := p.parseConditional()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("表达式%q在%q处有多余内容", src, t.text)
+	}
+	e := &Expr{src: src, root: root}
+	for name := range p.vars {
+		e.vars = append(e.vars, name)
+	}
+	return e, nil
+}
+
+// Vars 表达式引用的变量名
+func (e *Expr) Vars() []string {
+	return e.vars
+}
+
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Eval 计算表达式
+func (e *Expr) Eval(resolve Resolver) (float64, error) {
+	v, err := e.root(resolve)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, fmt.Errorf("表达式%q的结果无效: %v", e.src, v)
+	}
+	return v, nil
+}
+
+// ---------- 词法 ----------
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokIdent
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	num  float64
+}
+
+// 多字符运算符在前，优先匹配
+var operators = []string{"**", "//", "<<", ">>", "<=", ">=", "==", "!=", "+", "-", "*", "/", "%", "&", "|", "^", "~", "<", ">", "(", ")", ","}
+
+func tokenize(src string) ([]token, error) {
+	var tokens []token
+	rs := []rune(src)
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r >= '0' && r <= '9' || r == '.' && i+1 < len(rs) && rs[i+1] >= '0' && rs[i+1] <= '9':
+			j := i
+			for j < len(rs) && (unicode.IsLetter(rs[j]) || unicode.IsDigit(rs[j]) || rs[j] == '.' ||
+				(rs[j] == '+' || rs[j] == '-') && j > i && (rs[j-1] == 'e' || rs[j-1] == 'E') && !isPrefixed(rs[i:j])) {
+				j++
+			}
+			text := string(rs[i:j])
+			num, err := parseNumber(text)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: text, num: num})
+			i = j
+		case r == '[':
+			j := i + 1
+			for j < len(rs) && rs[j] != ']' {
+				j++
+			}
+			if j == len(rs) {
+				return nil, fmt.Errorf("表达式%q的方括号未闭合", src)
+			}
+			name := strings.TrimSpace(string(rs[i+1 : j]))
+			if name == "" {
+				return nil, fmt.Errorf("表达式%q中变量名为空", src)
+			}
+			tokens = append(tokens, token{kind: tokIdent, text: name})
+			i = j + 1
+		case unicode.IsLetter(r) || r == '_':
+			j := i
+			for j < len(rs) && (unicode.IsLetter(rs[j]) || unicode.IsDigit(rs[j]) || rs[j] == '_') {
+				j++
+			}
+			tokens = append(tokens, token{kind: tokIdent, text: string(rs[i:j])})
+			i = j
+		default:
+			matched := false
+			for _, op := range operators {
+				if strings.HasPrefix(string(rs[i:]), op) {
+					tokens = append(tokens, token{kind: tokOp, text: op})
+					i += len([]rune(op))
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("表达式%q中有无效字符%q", src, r)
+			}
+		}
+	}
+	return append(tokens, token{kind: tokEOF}), nil
+}
+
+func isPrefixed(rs []rune) bool {
+	return len(rs) >= 2 && rs[0] == '0' && strings.ContainsRune("xXbB", rs[1])
+}
+
+func parseNumber(text string) (float64, error) {
+	if isPrefixed([]rune(text)) {
+		base := 16
+		if text[1] == 'b' || text[1] == 'B' {
+			base = 2
+		}
+		n, err := strconv.ParseUint(text[2:], base, 64)
+		if err != nil {
+			return 0, fmt.Errorf("无效的数字: %s", text)
+		}
+		return float64(n), nil
+	}
+	n, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return 0, fmt.Errorf("无效的数字: %s", text)
+	}
+	return n, nil
+}
+
+// ---------- 语法 ----------
+
+type node func(Resolver) (float64, error)
+
+type exprParser struct {
+	tokens []token
+	pos    int
+	vars   map[string]bool
+}
+
+func (p *exprParser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// accept 当前为指定的运算符或关键字时消耗并返回 true
+func (p *exprParser) accept(text string) bool {
+	t := p.peek()
+	if (t.kind == tokOp || t.kind == tokIdent && isKeyword(t.text)) && t.text == text {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *exprParser) expect(text string) error {
+	if !p.accept(text) {
+		return fmt.Errorf("缺少%q，实际为%q", text, p.peek().text)
+	}
+	return nil
+}
+
+func isKeyword(s string) bool {
+	switch s {
+	case "if", "else", "and", "or", "not":
+		return true
+	}
+	return false
+}
+
+// parseConditional a if cond else b，右结合
+func (p *exprParser) parseConditional() (node, error) {
+	a, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.accept("if") {
+		return a, nil
+	}
+	cond, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("else"); err != nil {
+		return nil, err
+	}
+	b, err := p.parseConditional()
+	if err != nil {
+		return nil, err
+	}
+	return func(r Resolver) (float64, error) {
+		c, err := cond(r)
+		if err != nil {
+			return 0, err
+		}
+		if c != 0 {
+			return a(r)
+		}
+		return b(r)
+	}, nil
+}
+
+func (p *exprParser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("or") {
+		l := left
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = func(r Resolver) (float64, error) {
+			a, err := l(r)
+			if err != nil || a != 0 {
+				return truth(a != 0), err
+			}
+			b, err := right(r)
+			return truth(b != 0), err
+		}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("and") {
+		l := left
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = func(r Resolver) (float64, error) {
+			a, err := l(r)
+			if err != nil || a == 0 {
+				return 0, err
+			}
+			b, err := right(r)
+			return truth(b != 0), err
+		}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseNot() (node, error) {
+	if p.accept("not") {
+		x, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return func(r Resolver) (float64, error) {
+			v, err := x(r)
+			return truth(v == 0), err
+		}, nil
+	}
+	return p.parseBinary(0)
+}
+
+// 二元运算符优先级，从低到高
+var binaryLevels = [][]string{
+	{"<", "<=", ">", ">=", "==", "!="},
+	{"|"},
+	{"^"},
+	{"&"},
+	{"<<", ">>"},
+	{"+", "-"},
+	{"*", "/", "//", "%"},
+}
+
+func (p *exprParser) parseBinary(level int) (node, error) {
+	if level == len(binaryLevels) {
+		return p.parseUnary()
+	}
+	left, err := p.parseBinary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := ""
+		for _, candidate := range binaryLevels[level] {
+			if p.accept(candidate) {
+				op = candidate
+				break
+			}
+		}
+		if op == "" {
+			return left, nil
+		}
+		right, err := p.parseBinary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode(op, left, right)
+	}
+}
+
+func (p *exprParser) parseUnary() (node, error) {
+	for _, op := range []string{"-", "+", "~"} {
+		if p.accept(op) {
+			x, err := p.parseUnary()
+			if err != nil {
+				return nil, err
+			}
+			switch op {
+			case "-":
+				return func(r Resolver) (float64, error) {
+					v, err := x(r)
+					return -v, err
+				}, nil
+			case "~":
+				return func(r Resolver) (float64, error) {
+					v, err := x(r)
+					return float64(^int64(v)), err
+				}, nil
+			}
+			return x, nil
+		}
+	}
+	return p.parsePower()
+}
+
+// parsePower ** 右结合，优先级高于一元负号的右侧
+func (p *exprParser) parsePower() (node, error) {
+	base, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	if !p.accept("**") {
+		return base, nil
+	}
+	exp, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	return binaryNode("**", base, exp), nil
+}
+
+func (p *exprParser) parsePrimary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		v := t.num
+		return func(Resolver) (float64, error) { return v, nil }, nil
+	case tokIdent:
+		if isKeyword(t.text) {
+			return nil, fmt.Errorf("关键字%q位置错误", t.text)
+		}
+		if p.accept("(") {
+			return p.parseCall(t.text)
+		}
+		name := t.text
+		p.vars[name] = true
+		return func(r Resolver) (float64, error) {
+			v, ok := r(name)
+			if !ok {
+				return 0, &MissingError{Name: name}
+			}
+			return v, nil
+		}, nil
+	case tokOp:
+		if t.text == "(" {
+			x, err := p.parseConditional()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return x, nil
+		}
+	case tokEOF:
+		return nil, errors.New("表达式不完整")
+	}
+	return nil, fmt.Errorf("无效的符号%q", t.text)
+}
+
+func (p *exprParser) parseCall(name string) (node, error) {
+	fn, ok := functions[name]
+	if !ok {
+		return nil, fmt.Errorf("未知的函数%s", name)
+	}
+	var args []node
+	if !p.accept(")") {
+		for {
+			arg, err := p.parseConditional()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if p.accept(")") {
+				break
+			}
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(args) < fn.min || fn.max >= 0 && len(args) > fn.max {
+		return nil, fmt.Errorf("函数%s的参数个数错误", name)
+	}
+	return func(r Resolver) (float64, error) {
+		vals := make([]float64, len(args))
+		for i, arg := range args {
+			v, err := arg(r)
+			if err != nil {
+				return 0, err
+			}
+			vals[i] = v
+		}
+		return fn.call(vals), nil
+	}, nil
+}
+
+// MissingError 引用的变量不存在
+type MissingError struct {
+	Name string
+}
+
+func (e *MissingError) Error() string {
+	return fmt.Sprintf("变量%s不存在", e.Name)
+}
+
+func truth(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func binaryNode(op string, left, right node) node {
+	return func(r Resolver) (float64, error) {
+		a, err := left(r)
+		if err != nil {
+			return 0, err
+		}
+		b, err := right(r)
+		if err != nil {
+			return 0, err
+		}
+		switch op {
+		case "+":
+			return a + b, nil
+		case "-":
+			return a - b, nil
+		case "*":
+			return a * b, nil
+		case "/", "//", "%":
+			if b == 0 {
+				return 0, errors.New("除数为0")
+			}
+			switch op {
+			case "/":
+				return a / b, nil
+			case "//":
+				return math.Floor(a / b), nil
+			}
+			// 与 Python 一致，余数与除数同号
+			return a - b*math.Floor(a/b), nil
+		case "**":
+			return math.Pow(a, b), nil
+		case "<":
+			return truth(a < b), nil
+		case "<=":
+			return truth(a <= b), nil
+		case ">":
+			return truth(a > b), nil
+		case ">=":
+			return truth(a >= b), nil
+		case "==":
+			return truth(a == b), nil
+		case "!=":
+			return truth(a != b), nil
+		case "&":
+			return float64(int64(a) & int64(b)), nil
+		case "|":
+			return float64(int64(a) | int64(b)), nil
+		case "^":
+			return float64(int64(a) ^ int64(b)), nil
+		case "<<", ">>":
+			if b < 0 || b > 63 {
+				return 0, fmt.Errorf("移位位数%v无效", b)
+			}
+			if op == "<<" {
+				return float64(int64(a) << uint(b)), nil
+			}
+			return float64(int64(a) >> uint(b)), nil
+		}
+		return 0, fmt.Errorf("未知的运算符%s", op)
+	}
+}
+
+type function struct {
+	min, max int // 参数个数，max 为 -1 时不限
+	call     func([]float64) float64
+}
+
+var functions = map[string]function{
+	"abs":   {1, 1, func(a []float64) float64 { return math.Abs(a[0]) }},
+	"floor": {1, 1, func(a []float64) float64 { return math.Floor(a[0]) }},
+	"ceil":  {1, 1, func(a []float64) float64 { return math.Ceil(a[0]) }},
+	"sqrt":  {1, 1, func(a []float64) float64 { return math.Sqrt(a[0]) }},
+	"int":   {1, 1, func(a []float64) float64 { return math.Trunc(a[0]) }},
+	"pow":   {2, 2, func(a []float64) float64 { return math.Pow(a[0], a[1]) }},
+	"round": {1, 2, func(a []float64) float64 {
+		if len(a) == 1 {
+			return math.Round(a[0])
+		}
+		n := math.Pow(10, math.Trunc(a[1]))
+		return math.Round(a[0]*n) / n
+	}},
+	"min": {1, -1, func(a []float64) float64 {
+		m := a[0]
+		for _, v := range a[1:] {
+			m = math.Min(m, v)
+		}
+		return m
+	}},
+	"max": {1, -1, func(a []float64) float64 {
+		m := a[0]
+		for _, v := range a[1:] {
+			m = math.Max(m, v)
+		}
+		return m
+	}},
+}
@@ -0,0 +1,102 @@
+package expr
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEval(t *testing.T) {
+	vars := map[string]float64{"x": 10, "y": 4, "41_output_voltage": 220}
+	resolve := func(name string) (float64, bool) {
+		v, ok := vars[name]
+		return v, ok
+	}
+	tests := []struct {
+		src  string
+		want float64
+	}{
+		{"1 + 2 * 3", 7},
+		{"(1 + 2) * 3", 9},
+		{"2 ** 3 ** 2", 512},
+		{"-2 ** 2", -4},
+		{"10 - 4 - 3", 3},
+		{"x / y", 2.5},
+		{"x // y", 2},
+		{"-7 // 2", -4},
+		{"x % y", 2},
+		{"-7 % 3", 2},
+		{"0x10 + 0b11", 19},
+		{"1 + 2 < 4", 1},
+		{"x > 5 and y > 5", 0},
+		{"x > 5 or y > 5", 1},
+		{"not x", 0},
+		{"x if y > 3 else 0", 10},
+		{"x if y > 5 else 0", 0},
+		{"0x0F & 0x3C | 0x40", 0x4C},
+		{"1 << 4 >> 2", 4},
+		{"5 ^ 1", 4},
+		{"~0", -1},
+		{"abs(-3) + min(x, y) + max(1, 2, 3)", 10},
+		{"round(2.567, 2)", 2.57},
+		{"floor(-1.5) + ceil(1.2) + int(-1.7)", -1},
+		{"sqrt(16) + pow(2, 10)", 1028},
+		{"[41_output_voltage] * 0.1", 22},
+	}
+	for _, tt := range tests {
+		e, err := Compile(tt.src)
+		if err != nil {
+			t.Errorf("Compile(%q): %v", tt.src, err)
+			continue
+		}
+		got, err := e.Eval(resolve)
+		if err != nil {
+			t.Errorf("Eval(%q): %v", tt.src, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Eval(%q) = %v, want %v", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	resolve := func(name string) (float64, bool) { return 0, name == "zero" }
+	for _, src := range []string{"1 / 0", "1 // zero", "1 % 0", "1 << 64", "sqrt(-1)", "missing + 1"} {
+		e, err := Compile(src)
+		if err != nil {
+			t.Errorf("Compile(%q): %v", src, err)
+			continue
+		}
+		if v, err := e.Eval(resolve); err == nil {
+			t.Errorf("Eval(%q) = %v, 应返回错误", src, v)
+		}
+	}
+	e, _ := Compile("missing + 1")
+	_, err := e.Eval(resolve)
+	var missing *MissingError
+	if !errors.As(err, &missing) || missing.Name != "missing" {
+		t.Errorf("引用不存在的变量应返回 MissingError, 得到 %v", err)
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, src := range []string{"", "1 +", "(1 + 2", "1 2", "foo(1)", "abs()", "1 if 2", "[x", "$"} {
+		if _, err := Compile(src); err == nil {
+			t.Errorf("Compile(%q) 应返回错误", src)
+		}
+	}
+}
+
+func TestVars(t *testing.T) {
+	e, err := Compile("a + b * a + [c-1]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]bool)
+	for _, name := range e.Vars() {
+		got[name] = true
+	}
+	if len(got) != 3 || !got["a"] || !got["b"] || !got["c-1"] {
+		t.Errorf("Vars() = %v", e.Vars())
+	}
+}
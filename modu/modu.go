@@ -1,10 +1,18 @@
 package modu
 
+import (
+	"strconv"
+	"time"
+)
+
 type EParser struct {
 	Dev    EDev     `json:"dev"`    // 设备信息
 	Addrs  []EAddr  `json:"addrs"`  // 测点配置
 	Alarms []EAlarm `json:"alarms"` // 告警设定
 	Hmis   []EHmi   `json:"hmis"`   // 写屏设定
+	Traps  []ETrap  `json:"traps"`  // SNMP Trap 告警规则
+	Groups []EGroup `json:"groups"` // 重复结构
+	Calcs  []EAddr  `json:"calcs"`  // 计算测点，只使用 Formula 与测点描述字段
 }
 
 type EDev struct {
@@ -20,7 +28,34 @@ type EDev struct {
 	Separator        string `json:"separator"`        // 指标分割符
 	Version          string `json:"version"`          // 版本号
 	Addr             string `json:"addr"`             // 通讯地址
-	CrcNum           int    `json:"crcNum"`           //CRC数
+	CrcNum           int    `json:"crcNum"`           // 校验值字节数，0 为算法长度
+	Checksum         string `json:"checksum"`         // 校验算法，如 CRC16-MODBUS、LRC、SUM8
+	ChecksumRange    string `json:"checksumRange"`    // 校验计算范围 "起始..结束"，负数从校验值前倒数，如 "1.."
+	ChecksumOrder    string `json:"checksumOrder"`    // 校验值表示：LE、BE、HEX，为空时按算法惯用字节序
+	Community        string `json:"community"`        // SNMP 团体名
+	Preset           string `json:"preset"`           // 内置命令模板，如 "ups"、"ups+info"
+	RevLines         int    `json:"revLines"`         // 文本响应行数，收到该行数后结束
+	RevEndLine       string `json:"revEndLine"`       // 文本响应结束行，如 "OK"、"END"
+	RevIdle          int    `json:"revIdle"`          // 文本响应空闲间隔（毫秒），超过该时间无新数据即结束
+	RevTimeout       int    `json:"revTimeout"`       // 响应超时（毫秒），默认 1000
+	Encoding         string `json:"encoding"`         // 负载编码：HEX（默认）、BIN、DEC、BASE64
+	Frame            EFrame `json:"frame"`            // 自定义二进制帧模板
+	MaxRegisters     int    `json:"maxRegisters"`     // Modbus 单次读取的最大寄存器数（线圈、离散输入为位数），0 为协议上限
+	GapTolerance     int    `json:"gapTolerance"`     // Modbus 合并读取时允许跨越的未配置地址数
+	ForbiddenRanges  string `json:"forbiddenRanges"`  // Modbus 禁止读取的地址范围，如 "100-119;03:300-310"，可加功能码前缀
+}
+
+// EFrame 自定义二进制帧模板。模板为空格分隔的元素：十六进制字节（如 "55 AA"）、
+// "??"（响应中的任意一个字节）以及字段 {addr}、{cmd}、{len}、{data}、{crc}。
+// {addr} 取 EDev.Addr，{cmd} 取 EAddr.Command，请求中的 {data} 取 EAddr.CommandExtra，均为十六进制；
+// 响应中的 {data} 为负载，测点 StartAt/Length 相对负载以字节计。
+// {len} 的值为 {data} 的字节数加 LengthAdjust；{crc} 按 EDev 的 Checksum 声明，范围相对 {crc} 之前的帧内容。
+type EFrame struct {
+	Request      string `json:"request"`      // 请求模板，如 "55 AA {addr} {cmd} {len} {data} {crc} 0D"
+	Response     string `json:"response"`     // 响应模板，为空时与请求模板相同
+	LengthSize   int    `json:"lengthSize"`   // 长度字段字节数，默认 1
+	LengthOrder  string `json:"lengthOrder"`  // 长度字段字节序：BE（默认）或 LE
+	LengthAdjust int    `json:"lengthAdjust"` // 长度值与 {data} 字节数之差，如长度包含命令与校验时为 3
 }
 
 type EAddr struct {
@@ -32,13 +67,17 @@ type EAddr struct {
 	MetricUnit   string  `json:"metricUnit"`   // 指标单位
 	MetricCode   string  `json:"metricCode"`   // 测点名称
 	MetricIndex  int     `json:"metricIndex"`  // 测点序号
+	Line         int     `json:"line"`         // 多行文本响应中的行号（从 1 开始，忽略空行）
 	StartAt      int     `json:"startAt"`      // 起始位
 	Length       int     `json:"length"`       // 数据长度
 	EnumStr      string  `json:"enumStr"`      // 枚举
+	Pattern      string  `json:"pattern"`      // 文本协议正则提取，取命名分组 MetricCode 或 value，否则取第一个分组
+	Key          string  `json:"key"`          // 文本协议 key=value 提取的键
 	CutOffset    int     `json:"cutOffset"`    // 截取偏移
 	CutLength    int     `json:"cutLength"`    // 截取长度
 	Scale        float64 `json:"scale"`        // 缩放
 	ByteOrder    string  `json:"byteOrder"`    // 字节排序
+	Encoding     string  `json:"encoding"`     // 负载编码，为空时使用设备的编码
 	DataType     string  `json:"dataType"`     // 数据类型
 	ReMap        string  `json:"reMap"`        // 值映射
 	NotZeroAlarm string  `json:"notZeroAlarm"` // 非零告警
@@ -47,6 +86,28 @@ type EAddr struct {
 	SendPre      string  `json:"sendPre"`      // 发送前缀
 	SendSuf      string  `json:"sendSuf"`      // 发送后缀
 	RevSuf       string  `json:"revSuf"`       // 发送后缀
+	RangeMin     float64 `json:"rangeMin"`     // 有效范围下限
+	RangeMax     float64 `json:"rangeMax"`     // 有效范围上限，不大于下限时不检查
+	BitIndex     int     `json:"bitIndex"`     // 位域起始位，DataType 为 BIT 时使用
+	BitCount     int     `json:"bitCount"`     // 位域位数，默认 1（布尔）
+	BitOrder     string  `json:"bitOrder"`     // 位编号方式，LSB（默认，最低位为 0）或 MSB
+	BitWidth     int     `json:"bitWidth"`     // 按字编号时的字宽（位），如 16 表示第 17 位为第二个字的第 1 位
+	Bits         string  `json:"bits"`         // 状态字展开，如 "0:交流停电:交流停电告警;3:整流器故障"
+	Formula      string  `json:"formula"`      // 公式，raw 为解析值，可引用同一轮询周期其他测点的 MetricCode
+	Group        string  `json:"group"`        // 所属重复结构，StartAt 相对实例起始
+	After        string  `json:"after"`        // 紧跟的结构或测点，StartAt 相对其结束位置
+}
+
+// EGroup 重复结构，数量可取自数量字段（CountRef）或固定值（Count）。
+// 实例长度取 Stride 与实例内所有测点、子结构结束位置中的最大值。
+type EGroup struct {
+	Name     string `json:"name"`     // 结构名称
+	Parent   string `json:"parent"`   // 上级结构，嵌套时在每个上级实例内重复
+	After    string `json:"after"`    // 紧跟的结构或测点，StartAt 相对其结束位置
+	StartAt  int    `json:"startAt"`  // 起始位，顶层为绝对位置，嵌套时相对上级实例起始
+	CountRef string `json:"countRef"` // 数量字段的测点名称
+	Count    int    `json:"count"`    // 固定数量，CountRef 为空时使用
+	Stride   int    `json:"stride"`   // 每个实例的固定长度
 }
 
 type addrSortByCommond []EAddr
@@ -74,15 +135,83 @@ type EAlarm struct {
 	AlarmCont  string  // 告警描述
 }
 
+// ETrap SNMP Trap 告警规则，Operator 为空时只要 Trap OID 匹配即告警
+type ETrap struct {
+	TrapOid    string  `json:"trapOid"`    // Trap OID（v1 为 enterprise.0.specific 或标准 Trap OID）
+	VarOid     string  `json:"varOid"`     // 参与比较的变量 OID，可为前缀
+	Operator   string  `json:"operator"`   // 操作符
+	Value      float64 `json:"value"`      // 告警值
+	MetricName string  `json:"metricName"` // 指标名称
+	AlarmCont  string  `json:"alarmCont"`  // 告警描述
+}
+
+// AlarmEvent 告警事件，轮询与 Trap 产生相同结构
+type AlarmEvent struct {
+	Device     string    // 设备名称
+	MetricName string    // 指标名称
+	MetricCode string    // 测点名称
+	Value      float64   // 触发值
+	AlarmCont  string    // 告警描述
+	Source     string    // 来源：poll / trap
+	Remote     string    // 来源地址
+	Time       time.Time // 产生时间
+}
+
+// EHmi 写屏设定，写入值 = 工程值 / Scale
 type EHmi struct {
 	MetricName string  // 指标名称
 	FunCode    int     // 功能码
 	Address    int     // 寄存器地址
 	Scale      float64 // 缩放
 	StepNum    int     // 步长
+	DataType   string  // 数据类型，默认 UINT16，功能码 16 可写多个寄存器的类型
+	ByteOrder  string  // 字节序
+}
+
+// EModbusMap Modbus 服务端的寄存器映射
+type EModbusMap struct {
+	MetricCode string  `json:"metricCode"` // 测点名称
+	Table      string  `json:"table"`      // 寄存器表：holding（默认）或 input
+	Address    int     `json:"address"`    // 起始寄存器地址（从 0 开始）
+	DataType   string  `json:"dataType"`   // 数据类型，默认 UINT16
+	ByteOrder  string  `json:"byteOrder"`  // 字节序，默认大端
+	Scale      float64 `json:"scale"`      // 寄存器值 = 测点值 / Scale，0 表示不缩放
+	Hmi        string  `json:"hmi"`        // 写入时转发的写屏设定（EHmi.MetricName），为空时只读
 }
 
 type ParseValue struct {
-	Addr  EAddr
-	Value float64
+	Addr     EAddr
+	Value    float64   // 数值；布尔为 0/1，时间为 Unix 秒，字符串为 0
+	Raw      float64   // 公式计算前的数值，由 parser.ApplyFormulas 填写
+	Kind     ValueKind // 值类型，决定 Str、Time、Bool 中哪个有效
+	Str      string
+	Time     time.Time
+	Bool     bool
+	Label    string  // 枚举文本，来自 EnumStr 或 MAP 映射
+	Severity string  // 枚举级别
+	Quality  Quality // 数据质量
+	Err      error   // 质量非 QualityGood 时的原因
+}
+
+// ValueKind 测点值类型
+type ValueKind int
+
+const (
+	KindFloat  ValueKind = iota // 数值，只使用 Value
+	KindString                  // 字符串
+	KindTime                    // 时间
+	KindBool                    // 布尔
+)
+
+// String 返回值的文本形式
+func (v ParseValue) String() string {
+	switch v.Kind {
+	case KindString:
+		return v.Str
+	case KindTime:
+		return v.Time.Format("2006-01-02 15:04:05")
+	case KindBool:
+		return strconv.FormatBool(v.Bool)
+	}
+	return strconv.FormatFloat(v.Value, 'f', -1, 64)
 }
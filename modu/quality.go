@@ -0,0 +1,64 @@
+package modu
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Quality 测点数据质量
+type Quality int
+
+const (
+	QualityGood          Quality = iota // 正常
+	QualityExtractFailed                // 提取失败：响应中找不到测点数据
+	QualityDecodeFailed                 // 解析失败：数据无法按类型转换
+	QualityOutOfRange                   // 超出有效范围
+)
+
+func (q Quality) String() string {
+	switch q {
+	case QualityGood:
+		return "good"
+	case QualityExtractFailed:
+		return "extract-failed"
+	case QualityDecodeFailed:
+		return "decode-failed"
+	case QualityOutOfRange:
+		return "out-of-range"
+	}
+	return fmt.Sprintf("quality(%d)", int(q))
+}
+
+// PointError 单个测点的解析错误
+type PointError struct {
+	MetricCode string
+	Quality    Quality
+	Err        error
+}
+
+func (e *PointError) Error() string {
+	return fmt.Sprintf("%s %s: %v", e.MetricCode, e.Quality, e.Err)
+}
+
+func (e *PointError) Unwrap() error {
+	return e.Err
+}
+
+// ParseErrors 一次 ParseResponse 中所有失败测点的错误
+type ParseErrors []*PointError
+
+func (e ParseErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, pe := range e {
+		msgs[i] = pe.Error()
+	}
+	return fmt.Sprintf("%d个测点解析失败: %s", len(e), strings.Join(msgs, "; "))
+}
+
+// Err 没有错误时返回 nil，避免返回值为非 nil 的空切片
+func (e ParseErrors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
@@ -0,0 +1,175 @@
+package parser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/zoneBen/ProtoHub/modu"
+)
+
+// 位域数据类型，HexParser 取十六进制数据，SimpleParser 取 0/1 组成的二进制文本
+const bitDataType = "BIT"
+
+// IsBitType 判断是否为位域类型
+func IsBitType(dataType string) bool {
+	return strings.EqualFold(dataType, bitDataType)
+}
+
+// ExpandBits 将配置了 Bits 的状态字展开为逐位的布尔测点，状态字本身保留。
+// Bits 格式为 "位:名称[:告警描述]"，以分号分隔；带告警描述的位开启非零告警。
+// 展开的测点 MetricCode 为状态字 MetricCode 加 "_位"。
+func ExpandBits(addrs []modu.EAddr) ([]modu.EAddr, error) {
+	var out []modu.EAddr
+	for _, addr := range addrs {
+		if addr.Bits == "" {
+			out = append(out, addr)
+			continue
+		}
+		word := addr
+		word.Bits = ""
+		out = append(out, word)
+		for _, item := range strings.Split(addr.Bits, ";") {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				continue
+			}
+			parts := strings.SplitN(item, ":", 3)
+			index, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("测点%s的位定义%q无效", addr.MetricCode, item)
+			}
+			bit := word
+			bit.DataType = bitDataType
+			bit.BitIndex = index
+			bit.BitCount = 1
+			bit.Scale = 0
+			bit.Foundation = 0
+			bit.RangeMin, bit.RangeMax = 0, 0
+			bit.MetricCode = fmt.Sprintf("%s_%d", addr.MetricCode, index)
+			bit.MetricName = fmt.Sprintf("%s#%d", addr.MetricName, index)
+			bit.NotZeroAlarm = ""
+			bit.AlarmCont = ""
+			if len(parts) > 1 && strings.TrimSpace(parts[1]) != "" {
+				bit.MetricName = strings.TrimSpace(parts[1])
+			}
+			if len(parts) > 2 && strings.TrimSpace(parts[2]) != "" {
+				bit.NotZeroAlarm = "1"
+				bit.AlarmCont = strings.TrimSpace(parts[2])
+			}
+			out = append(out, bit)
+		}
+	}
+	return out, nil
+}
+
+// extractBits 从原始数据中取出位域。
+// 未设置 BitWidth 时整段数据按 ByteOrder 视为一个整数；设置 BitWidth 时按字编号，
+// 字按数据中的先后顺序排列，ByteOrder 作用于每个字。
+// LSB 编号时位号越大越高位，MSB 编号时位号 0 为最高位。
+func extractBits(data []byte, addr modu.EAddr) (uint64, error) {
+	count := addr.BitCount
+	if count <= 0 {
+		count = 1
+	}
+	if count > 64 {
+		return 0, fmt.Errorf("位数%d超过64", count)
+	}
+	if addr.BitIndex < 0 {
+		return 0, fmt.Errorf("起始位%d无效", addr.BitIndex)
+	}
+	msb := false
+	switch strings.ToUpper(addr.BitOrder) {
+	case "", "LSB":
+	case "MSB":
+		msb = true
+	default:
+		return 0, fmt.Errorf("不支持的位编号方式: %s", addr.BitOrder)
+	}
+	if len(data) == 0 {
+		return 0, fmt.Errorf("位域数据为空")
+	}
+	width := addr.BitWidth
+	if width <= 0 {
+		width = len(data) * 8
+	}
+	if width%8 == 0 {
+		if len(data)%(width/8) != 0 {
+			return 0, fmt.Errorf("数据长度%d字节不是字宽%d位的整数倍", len(data), width)
+		}
+		ordered := make([]byte, 0, len(data))
+		for i := 0; i < len(data); i += width / 8 {
+			w, err := toBigEndian(data[i:i+width/8], addr.ByteOrder)
+			if err != nil {
+				return 0, err
+			}
+			ordered = append(ordered, w...)
+		}
+		data = ordered
+	}
+	total := len(data) * 8
+	var v uint64
+	for k := 0; k < count; k++ {
+		index := addr.BitIndex + k
+		word, bit := index/width, index%width
+		if (word+1)*width > total {
+			return 0, fmt.Errorf("第%d位超出数据范围", index)
+		}
+		// pos 为从数据最高位开始数的位置
+		pos := word*width + bit
+		if !msb {
+			pos = word*width + width - 1 - bit
+		}
+		b := uint64(data[pos/8]>>(7-uint(pos%8))) & 1
+		if msb {
+			v = v<<1 | b
+		} else {
+			v |= b << uint(k)
+		}
+	}
+	return v, nil
+}
+
+// bitValue 生成位域的解析值，单个位为布尔值
+func bitValue(data []byte, addr modu.EAddr) (modu.ParseValue, error) {
+	v := modu.ParseValue{Addr: addr}
+	u, err := extractBits(data, addr)
+	if err != nil {
+		return v, err
+	}
+	if addr.BitCount <= 1 {
+		v.Kind, v.Bool = modu.KindBool, u != 0
+		setTypedValue(&v)
+		return v, nil
+	}
+	v.Value = float64(u)
+	if addr.Scale != 0 {
+		v.Value *= addr.Scale
+	}
+	v.Value += addr.Foundation
+	return v, nil
+}
+
+// binaryText 将 0/1 组成的文本转换为字节，右侧补 0 至整字节，空白字符忽略，返回数据与有效位数
+func binaryText(text string) ([]byte, int, error) {
+	var digits []byte
+	for _, c := range []byte(text) {
+		switch c {
+		case '0', '1':
+			digits = append(digits, c)
+		case ' ', '\t', '\r', '\n':
+		default:
+			return nil, 0, fmt.Errorf("二进制文本包含无效字符: %q", text)
+		}
+	}
+	if len(digits) == 0 {
+		return nil, 0, fmt.Errorf("二进制文本为空")
+	}
+	data := make([]byte, (len(digits)+7)/8)
+	for i, c := range digits {
+		if c == '1' {
+			data[i/8] |= 0x80 >> uint(i%8)
+		}
+	}
+	return data, len(digits), nil
+}
@@ -4,6 +4,8 @@ import (
 	"encoding/binary"
 	"fmt"
 	"math"
+	"strconv"
+	"strings"
 )
 
 // 自定义混合字节序类型
@@ -81,126 +83,344 @@ func (m *MixedByteOrder) String() string {
 	return fmt.Sprintf("Custom(%v)", m.order)
 }
 
-// 获取字节序
-func getByteOrder(order string) binary.ByteOrder {
+// 获取字节序，常用的大小端写法返回标准字节序，其他字母排列返回 nil，由 reorderBytes 处理
+func getByteOrder(order string) (binary.ByteOrder, error) {
 	switch order {
-	case "AB", "ABCD", "ABCDEFGH":
-		return binary.BigEndian
+	case "", "AB", "ABCD", "ABCDEFGH":
+		return binary.BigEndian, nil
 	case "BA", "DCBA", "HGFEDCBA":
-		return binary.LittleEndian
-	case "BADC":
-		return &MixedByteOrder{order: []int{1, 0, 3, 2}} // Swap each 16-bit word
-	case "CDAB":
-		return &MixedByteOrder{order: []int{2, 3, 0, 1}} // Swap two 16-bit words
-	case "GHEFCDAB":
-		return &MixedByteOrder{order: []int{6, 7, 4, 5, 2, 3, 0, 1}}
-	default:
-		panic("Unsupported byte order: " + order)
+		return binary.LittleEndian, nil
+	}
+	for i := 0; i < len(order); i++ {
+		if order[i] < 'A' || order[i] > 'Z' {
+			return nil, fmt.Errorf("不支持的字节序: %s", order)
+		}
+	}
+	return nil, nil
+}
+
+// fitByteOrder order 比数据长时只保留数据范围内的字母，
+// 设备统一配置 "BADC" 时 16 位测点按 "BA"、"CDAB" 时按 "AB" 解析
+func fitByteOrder(order string, n int) string {
+	if len(order) <= n {
+		return order
+	}
+	var short []byte
+	for i := 0; i < len(order); i++ {
+		if int(order[i])-'A' < n {
+			short = append(short, order[i])
+		}
 	}
+	return string(short)
 }
 
-// 自定义混合顺序处理函数
-func reorderBytes(data []byte, order string) []byte {
+// 自定义混合顺序处理函数，order 中第 i 个字母表示结果第 i 个字节（大端）取自 data 的哪个位置，
+// 如 "CDAB" 为字交换、"BADC" 为字内字节交换
+func reorderBytes(data []byte, order string) ([]byte, error) {
+	order = fitByteOrder(order, len(data))
 	if len(order) != len(data) {
-		panic("Byte order length must match data length")
+		return nil, fmt.Errorf("字节序%s长度与数据长度%d不一致", order, len(data))
 	}
 	res := make([]byte, len(data))
+	used := make([]bool, len(data))
 	for i := 0; i < len(order); i++ {
-		srcPos := order[i] - 'A'
-		if int(srcPos) >= len(data) {
-			panic("Invalid byte order mapping")
+		srcPos := int(order[i]) - 'A'
+		if srcPos < 0 || srcPos >= len(data) || used[srcPos] {
+			return nil, fmt.Errorf("字节序%s不是有效的字母排列", order)
 		}
+		used[srcPos] = true
 		res[i] = data[srcPos]
 	}
-	return res
+	return res, nil
 }
 
-// 将 bytes 转换为 float64
-func convertToFloat(data []byte, dataType, byteOrder string) float64 {
-	order := getByteOrder(byteOrder)
+// 将 bytes 转换为 float64，数据长度不足、类型或字节序不支持时返回错误
+func convertToFloat(data []byte, dataType, byteOrder string) (float64, error) {
+	if IsBCDType(dataType) {
+		return convertBCD(data, dataType, byteOrder)
+	}
+	size := DataTypeSize(dataType)
+	if size == 0 {
+		return 0, fmt.Errorf("不支持的数据类型: %s", dataType)
+	}
+	if len(data) < size {
+		return 0, fmt.Errorf("%s需要%d字节, 实际%d字节", dataType, size, len(data))
+	}
+	data, err := toBigEndian(data[:size], byteOrder)
+	if err != nil {
+		return 0, err
+	}
+	u := beUint(data)
 
 	switch dataType {
-	case "INT8":
-		val := int8(data[0])
-		return float64(val)
-	case "UINT8":
-		val := data[0]
-		return float64(val)
-	case "INT16":
-		if order == nil {
-			data = reorderBytes(data[:2], byteOrder)
-		} else {
-			data = data[:2]
+	case "INT8", "INT16", "INT24", "INT32", "INT48", "INT64":
+		return float64(signExtend(u, size*8)), nil
+	case "UINT8", "UINT16", "UINT24", "UINT32", "UINT48", "UINT64":
+		return float64(u), nil
+	case "FLOAT16":
+		return float16ToFloat(uint16(u)), nil
+	case "FLOAT32-IEEE", "FLOAT32":
+		return float64(math.Float32frombits(uint32(u))), nil
+	case "FLOAT64-IEEE", "FLOAT64":
+		return math.Float64frombits(u), nil
+	}
+	if signed, m, n, ok := parseQFormat(dataType); ok {
+		bits := m + n
+		u &= 1<<uint(bits) - 1
+		if signed {
+			return float64(signExtend(u, bits)) / math.Exp2(float64(n)), nil
 		}
-		val := int16(order.Uint16(data))
-		return float64(val)
-	case "UINT16":
-		if order == nil {
-			data = reorderBytes(data[:2], byteOrder)
-		} else {
-			data = data[:2]
+		return float64(u) / math.Exp2(float64(n)), nil
+	}
+	return 0, fmt.Errorf("不支持的数据类型: %s", dataType)
+}
+
+// toBigEndian 按字节序将数据整理为大端顺序
+func toBigEndian(data []byte, byteOrder string) ([]byte, error) {
+	if len(data) == 1 {
+		return data, nil
+	}
+	order, err := getByteOrder(byteOrder)
+	if err != nil {
+		return nil, err
+	}
+	switch order {
+	case binary.BigEndian:
+		return data, nil
+	case binary.LittleEndian:
+		res := make([]byte, len(data))
+		for i := range data {
+			res[i] = data[len(data)-1-i]
 		}
-		val := order.Uint16(data)
-		return float64(val)
-	case "UINT32":
-		if order == nil {
-			data = reorderBytes(data[:4], byteOrder)
-		} else {
-			data = data[:4]
+		return res, nil
+	}
+	return reorderBytes(data, byteOrder)
+}
+
+func beUint(data []byte) uint64 {
+	var u uint64
+	for _, b := range data {
+		u = u<<8 | uint64(b)
+	}
+	return u
+}
+
+// signExtend 将 bits 位的补码扩展为 int64
+func signExtend(u uint64, bits int) int64 {
+	shift := uint(64 - bits)
+	return int64(u<<shift) >> shift
+}
+
+// float16ToFloat IEEE 754 半精度浮点数
+func float16ToFloat(h uint16) float64 {
+	sign := 1.0
+	if h&0x8000 != 0 {
+		sign = -1
+	}
+	exp := int(h>>10) & 0x1F
+	frac := float64(h & 0x3FF)
+	switch exp {
+	case 0:
+		return sign * frac * math.Exp2(-24)
+	case 0x1F:
+		if frac == 0 {
+			return math.Inf(int(sign))
 		}
-		val := order.Uint32(data)
-		return float64(val)
-	case "INT64":
-		if order == nil {
-			data = reorderBytes(data[:8], byteOrder)
-		} else {
-			data = data[:8]
+		return math.NaN()
+	}
+	return sign * (1 + frac/1024) * math.Exp2(float64(exp-15))
+}
+
+// parseQFormat 解析定点数格式 Qm.n（有符号，m 含符号位）与 UQm.n（无符号），
+// FIXED、UFIXED 分别等同 Q16.16、UQ16.16
+func parseQFormat(dataType string) (signed bool, m, n int, ok bool) {
+	switch dataType {
+	case "FIXED":
+		return true, 16, 16, true
+	case "UFIXED":
+		return false, 16, 16, true
+	}
+	s := strings.ToUpper(dataType)
+	signed = true
+	if strings.HasPrefix(s, "UQ") {
+		signed = false
+		s = s[2:]
+	} else if strings.HasPrefix(s, "Q") {
+		s = s[1:]
+	} else {
+		return false, 0, 0, false
+	}
+	parts := strings.Split(s, ".")
+	if len(parts) != 2 {
+		return false, 0, 0, false
+	}
+	m, err1 := strconv.Atoi(parts[0])
+	n, err2 := strconv.Atoi(parts[1])
+	if err1 != nil || err2 != nil || m < 0 || n < 0 || m+n < 1 || m+n > 64 || (signed && m < 1) {
+		return false, 0, 0, false
+	}
+	return signed, m, n, true
+}
+
+// IsBCDType 判断是否为 BCD 类型：BCD 压缩 BCD，SBCD 首字节最高位为符号位，
+// PBCD 末尾半字节为符号（B/D 为负，A/C/E/F 为正）；可带 ".n" 后缀表示 n 位隐含小数，如 "BCD.2"
+func IsBCDType(dataType string) bool {
+	_, _, ok := parseBCDType(dataType)
+	return ok
+}
+
+func parseBCDType(dataType string) (kind string, decimals int, ok bool) {
+	kind = strings.ToUpper(dataType)
+	if i := strings.Index(kind, "."); i >= 0 {
+		n, err := strconv.Atoi(kind[i+1:])
+		if err != nil || n < 0 || n > 18 {
+			return "", 0, false
 		}
-		val := int64(order.Uint64(data))
-		return float64(val)
-	case "UINT64":
-		if order == nil {
-			data = reorderBytes(data[:8], byteOrder)
-		} else {
-			data = data[:8]
+		kind, decimals = kind[:i], n
+	}
+	switch kind {
+	case "BCD", "SBCD", "PBCD":
+		return kind, decimals, true
+	}
+	return "", 0, false
+}
+
+// convertBCD 按字节序整理为高位在前后逐个半字节解码，长度取数据全长
+func convertBCD(data []byte, dataType, byteOrder string) (float64, error) {
+	kind, decimals, _ := parseBCDType(dataType)
+	if len(data) == 0 {
+		return 0, fmt.Errorf("%s数据为空", dataType)
+	}
+	data, err := toBigEndian(data, byteOrder)
+	if err != nil {
+		return 0, err
+	}
+	nibbles := make([]byte, 0, len(data)*2)
+	for _, b := range data {
+		nibbles = append(nibbles, b>>4, b&0x0F)
+	}
+	negative := false
+	switch kind {
+	case "SBCD":
+		negative = nibbles[0]&0x08 != 0
+		nibbles[0] &= 0x07
+	case "PBCD":
+		sign := nibbles[len(nibbles)-1]
+		switch sign {
+		case 0x0B, 0x0D:
+			negative = true
+		case 0x0A, 0x0C, 0x0E, 0x0F:
+		default:
+			return 0, fmt.Errorf("%s符号位无效: %X", dataType, sign)
 		}
-		val := order.Uint64(data)
-		return float64(val)
-	case "FLOAT32-IEEE", "FLOAT32":
-		if order == nil {
-			data = reorderBytes(data[:4], byteOrder)
-		} else {
-			data = data[:4]
+		nibbles = nibbles[:len(nibbles)-1]
+	}
+	var v float64
+	for _, d := range nibbles {
+		if d > 9 {
+			return 0, fmt.Errorf("%s包含非十进制数字: %X", dataType, data)
 		}
-		val := math.Float32frombits(order.Uint32(data))
-		return float64(val)
+		v = v*10 + float64(d)
+	}
+	v /= math.Pow10(decimals)
+	if negative {
+		v = -v
+	}
+	return v, nil
+}
+
+// DataTypeSize 返回数据类型占用的字节数，未知或变长类型（如 BCD）返回 0
+func DataTypeSize(dataType string) int {
+	switch dataType {
+	case "INT8", "UINT8":
+		return 1
+	case "INT16", "UINT16", "FLOAT16":
+		return 2
+	case "INT24", "UINT24":
+		return 3
+	case "INT32", "UINT32", "FLOAT32-IEEE", "FLOAT32":
+		return 4
+	case "INT48", "UINT48":
+		return 6
+	case "INT64", "UINT64", "FLOAT64-IEEE", "FLOAT64":
+		return 8
+	}
+	if _, m, n, ok := parseQFormat(dataType); ok {
+		return (m + n + 7) / 8
+	}
+	return 0
+}
+
+// EncodeValue 将数值按数据类型与字节序编码，是 convertToFloat 的逆过程，用于写入与对外提供数据；
+// 整数与定点数四舍五入，超出类型范围时返回错误
+func EncodeValue(v float64, dataType, byteOrder string) ([]byte, error) {
+	size := DataTypeSize(dataType)
+	if size == 0 || dataType == "FLOAT16" {
+		return nil, fmt.Errorf("不支持编码的数据类型: %s", dataType)
+	}
+	if math.IsNaN(v) && !strings.HasPrefix(dataType, "FLOAT") {
+		return nil, fmt.Errorf("%s不能表示NaN", dataType)
+	}
+	var u uint64
+	switch dataType {
+	case "FLOAT32-IEEE", "FLOAT32":
+		u = uint64(math.Float32bits(float32(v)))
 	case "FLOAT64-IEEE", "FLOAT64":
-		if order == nil {
-			data = reorderBytes(data[:8], byteOrder)
-		} else {
-			data = data[:8]
+		u = math.Float64bits(v)
+	default:
+		signed, bits := strings.HasPrefix(dataType, "INT"), size*8
+		if s, m, n, ok := parseQFormat(dataType); ok {
+			signed, bits = s, m+n
+			v *= math.Exp2(float64(n))
 		}
-		val := math.Float64frombits(order.Uint64(data))
-		return val
-	case "FIXED":
-		// 假设是 32-bit fixed: 16.16 格式
-		if order == nil {
-			data = reorderBytes(data[:4], byteOrder)
-		} else {
-			data = data[:4]
+		r := math.Round(v)
+		lo, hi := 0.0, math.Exp2(float64(bits))-1
+		if signed {
+			lo, hi = -math.Exp2(float64(bits-1)), math.Exp2(float64(bits-1))-1
 		}
-		val := int64(order.Uint32(data))
-		return float64(val) / (1 << 16)
-	case "UFIXED":
-		// 假设是 32-bit ufixed: 16.16 格式
-		if order == nil {
-			data = reorderBytes(data[:4], byteOrder)
+		if r < lo || r > hi {
+			return nil, fmt.Errorf("数值%v超出%s范围", v, dataType)
+		}
+		if signed {
+			u = uint64(int64(r))
 		} else {
-			data = data[:4]
+			u = uint64(r)
 		}
-		val := order.Uint32(data)
-		return float64(val) / (1 << 16)
-	default:
-		panic("Unsupported data type: " + dataType)
 	}
+	be := make([]byte, size)
+	for i := size - 1; i >= 0; i-- {
+		be[i] = byte(u)
+		u >>= 8
+	}
+	return fromBigEndian(be, byteOrder)
+}
+
+// fromBigEndian 将大端顺序的数据按字节序排列，是 toBigEndian 的逆过程
+func fromBigEndian(be []byte, byteOrder string) ([]byte, error) {
+	if len(be) == 1 {
+		return be, nil
+	}
+	order, err := getByteOrder(byteOrder)
+	if err != nil {
+		return nil, err
+	}
+	switch order {
+	case binary.BigEndian:
+		return be, nil
+	case binary.LittleEndian:
+		res := make([]byte, len(be))
+		for i := range be {
+			res[i] = be[len(be)-1-i]
+		}
+		return res, nil
+	}
+	if _, err := reorderBytes(be, byteOrder); err != nil {
+		return nil, err
+	}
+	byteOrder = fitByteOrder(byteOrder, len(be))
+	res := make([]byte, len(be))
+	for i := 0; i < len(byteOrder); i++ {
+		res[byteOrder[i]-'A'] = be[i]
+	}
+	return res, nil
 }
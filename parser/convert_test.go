@@ -0,0 +1,150 @@
+package parser
+
+import "testing"
+
+func TestConvertToFloat(t *testing.T) {
+	tests := []struct {
+		data      []byte
+		dataType  string
+		byteOrder string
+		want      float64
+	}{
+		{[]byte{0xFF}, "INT8", "", -1},
+		{[]byte{0xFF}, "UINT8", "", 255},
+		{[]byte{0x12, 0x34}, "UINT16", "AB", 0x1234},
+		{[]byte{0x12, 0x34}, "UINT16", "BA", 0x3412},
+		{[]byte{0xFF, 0xFE}, "INT16", "", -2},
+		{[]byte{0x12, 0x34, 0x56, 0x78}, "UINT32", "ABCD", 0x12345678},
+		{[]byte{0x12, 0x34, 0x56, 0x78}, "UINT32", "DCBA", 0x78563412},
+		{[]byte{0x12, 0x34, 0x56, 0x78}, "UINT32", "CDAB", 0x56781234},
+		{[]byte{0x12, 0x34, 0x56, 0x78}, "UINT32", "BADC", 0x34127856},
+		{[]byte{0x3F, 0x80, 0x00, 0x00}, "FLOAT32", "", 1},
+		{[]byte{0x00, 0x00, 0x80, 0x3F}, "FLOAT32", "DCBA", 1},
+		{[]byte{0x00, 0x00, 0x3F, 0x80}, "FLOAT32", "CDAB", 1},
+		// 设备统一配置 4 字节字序时，16 位测点按字内顺序解析
+		{[]byte{0x12, 0x34}, "UINT16", "BADC", 0x3412},
+		{[]byte{0x12, 0x34}, "UINT16", "CDAB", 0x1234},
+		{[]byte{0x12, 0x34}, "UINT16", "GHEFCDAB", 0x1234},
+		{[]byte{0x12, 0x34, 0x56, 0x78}, "UINT32", "GHEFCDAB", 0x56781234},
+		{[]byte{0x3F, 0xF0, 0, 0, 0, 0, 0, 0}, "FLOAT64", "", 1},
+	}
+	for _, tt := range tests {
+		got, err := convertToFloat(tt.data, tt.dataType, tt.byteOrder)
+		if err != nil {
+			t.Errorf("convertToFloat(%X, %s, %q): %v", tt.data, tt.dataType, tt.byteOrder, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("convertToFloat(%X, %s, %q) = %v, want %v", tt.data, tt.dataType, tt.byteOrder, got, tt.want)
+		}
+	}
+}
+
+func TestConvertToFloatErrors(t *testing.T) {
+	tests := []struct {
+		data      []byte
+		dataType  string
+		byteOrder string
+	}{
+		{[]byte{0x12}, "UINT16", ""},
+		{[]byte{0x12, 0x34, 0x56}, "FLOAT32", ""},
+		{[]byte{0x12, 0x34}, "STRING", ""},
+		{[]byte{0x12, 0x34}, "UINT16", "A-B"},
+		{[]byte{0x12, 0x34, 0x56, 0x78}, "UINT32", "AABB"},
+		{[]byte{0x12, 0x34, 0x56, 0x78}, "UINT32", "ABC"},
+	}
+	for _, tt := range tests {
+		if v, err := convertToFloat(tt.data, tt.dataType, tt.byteOrder); err == nil {
+			t.Errorf("convertToFloat(%X, %s, %q) = %v, 应返回错误", tt.data, tt.dataType, tt.byteOrder, v)
+		}
+	}
+}
+
+func TestConvertExtendedTypes(t *testing.T) {
+	tests := []struct {
+		data      []byte
+		dataType  string
+		byteOrder string
+		want      float64
+	}{
+		{[]byte{0x01, 0x02, 0x03}, "UINT24", "", 0x010203},
+		{[]byte{0x03, 0x02, 0x01}, "UINT24", "CBA", 0x010203},
+		{[]byte{0xFF, 0xFF, 0xFE}, "INT24", "", -2},
+		{[]byte{0x00, 0x01, 0x00, 0x00, 0x00, 0x00}, "UINT48", "", 1 << 32},
+		{[]byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}, "INT48", "", -1},
+		{[]byte{0x3C, 0x00}, "FLOAT16", "", 1},
+		{[]byte{0xC0, 0x00}, "FLOAT16", "", -2},
+		{[]byte{0x00, 0x3C}, "FLOAT16", "BA", 1},
+		{[]byte{0x35, 0x55}, "FLOAT16", "", 0.333251953125},
+		{[]byte{0x00, 0x01}, "FLOAT16", "", 1.0 / (1 << 24)},
+		{[]byte{0x01, 0x80}, "Q8.8", "", 1.5},
+		{[]byte{0xFF, 0x00}, "Q8.8", "", -1},
+		{[]byte{0xFF, 0x00}, "UQ8.8", "", 255},
+		{[]byte{0x40, 0x00}, "Q1.15", "", 0.5},
+		{[]byte{0x18}, "UQ4.4", "", 1.5},
+		{[]byte{0x00, 0x01, 0x80, 0x00}, "FIXED", "", 1.5},
+		{[]byte{0xFF, 0xFF, 0x00, 0x00}, "FIXED", "", -1},
+	}
+	for _, tt := range tests {
+		got, err := convertToFloat(tt.data, tt.dataType, tt.byteOrder)
+		if err != nil {
+			t.Errorf("convertToFloat(%X, %s, %q): %v", tt.data, tt.dataType, tt.byteOrder, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("convertToFloat(%X, %s, %q) = %v, want %v", tt.data, tt.dataType, tt.byteOrder, got, tt.want)
+		}
+	}
+	for _, dataType := range []string{"Q0.8", "Q8", "UQ40.40", "QX.Y"} {
+		if DataTypeSize(dataType) != 0 {
+			t.Errorf("DataTypeSize(%q) 应为 0", dataType)
+		}
+	}
+}
+
+func TestConvertBCD(t *testing.T) {
+	tests := []struct {
+		data      []byte
+		dataType  string
+		byteOrder string
+		want      float64
+	}{
+		{[]byte{0x12, 0x34}, "BCD", "", 1234},
+		{[]byte{0x34, 0x12}, "BCD", "BA", 1234},
+		{[]byte{0x12, 0x34}, "BCD.2", "", 12.34},
+		{[]byte{0x00, 0x00, 0x12, 0x34}, "bcd.1", "", 123.4},
+		{[]byte{0x81, 0x23}, "SBCD", "", -123},
+		{[]byte{0x01, 0x23}, "SBCD", "", 123},
+		{[]byte{0x12, 0x3C}, "PBCD", "", 123},
+		{[]byte{0x12, 0x3D}, "PBCD", "", -123},
+		{[]byte{0x12, 0x3B}, "PBCD.1", "", -12.3},
+	}
+	for _, tt := range tests {
+		got, err := convertToFloat(tt.data, tt.dataType, tt.byteOrder)
+		if err != nil {
+			t.Errorf("convertToFloat(%X, %s, %q): %v", tt.data, tt.dataType, tt.byteOrder, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("convertToFloat(%X, %s, %q) = %v, want %v", tt.data, tt.dataType, tt.byteOrder, got, tt.want)
+		}
+	}
+	errTests := []struct {
+		data     []byte
+		dataType string
+	}{
+		{[]byte{0x1A}, "BCD"},
+		{[]byte{0x12, 0x34}, "PBCD"},
+		{nil, "BCD"},
+	}
+	for _, tt := range errTests {
+		if v, err := convertToFloat(tt.data, tt.dataType, ""); err == nil {
+			t.Errorf("convertToFloat(%X, %s) = %v, 应返回错误", tt.data, tt.dataType, v)
+		}
+	}
+	for _, dataType := range []string{"BCD.x", "BCD.19", "XBCD"} {
+		if IsBCDType(dataType) {
+			t.Errorf("IsBCDType(%q) 应为 false", dataType)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package parser
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/zoneBen/ProtoHub/modu"
+)
+
+// 负载编码，决定 HexParser 如何将提取的数据还原为字节
+const (
+	EncodingHex     = "HEX"    // ASCII 十六进制，StartAt/Length 以字符计（默认，电总等协议）
+	EncodingBinary  = "BIN"    // 原始二进制，StartAt/Length 以字节计
+	EncodingDecimal = "DEC"    // ASCII 十进制数值文本，直接按数值解析
+	EncodingBase64  = "BASE64" // 整段 Base64，解码后 StartAt/Length 以字节计
+)
+
+// PayloadEncoding 测点的负载编码，EAddr.Encoding 优先，其次 EDev.Encoding，默认 HEX
+func PayloadEncoding(dev *modu.EParser, addr modu.EAddr) string {
+	if addr.Encoding != "" {
+		return strings.ToUpper(addr.Encoding)
+	}
+	if dev != nil && dev.Dev.Encoding != "" {
+		return strings.ToUpper(dev.Dev.Encoding)
+	}
+	return EncodingHex
+}
+
+// payloadBytes 将 Extract 得到的数据还原为字节，DEC 编码不经过此步骤
+func payloadBytes(buf []byte, encoding string) ([]byte, error) {
+	switch encoding {
+	case EncodingHex:
+		return hex.DecodeString(string(buf))
+	case EncodingBinary, EncodingBase64:
+		// Base64 在 Extract 时已整段解码
+		return buf, nil
+	}
+	return nil, fmt.Errorf("不支持的负载编码: %s", encoding)
+}
+
+// decodeBase64 整段解码，忽略空白字符
+func decodeBase64(data []byte) ([]byte, error) {
+	s := strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\r' || r == '\n' || r == '\t' {
+			return -1
+		}
+		return r
+	}, string(data))
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("Base64解码失败: %w", err)
+	}
+	return b, nil
+}
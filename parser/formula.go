@@ -0,0 +1,154 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/zoneBen/ProtoHub/internal/expr"
+	"github.com/zoneBen/ProtoHub/modu"
+)
+
+// 公式中表示测点自身解析值的变量名
+const rawVar = "raw"
+
+var formulaCache sync.Map
+
+// CompileFormula 编译并缓存公式
+func CompileFormula(formula string) (*expr.Expr, error) {
+	if e, ok := formulaCache.Load(formula); ok {
+		return e.(*expr.Expr), nil
+	}
+	e, err := expr.Compile(formula)
+	if err != nil {
+		return nil, err
+	}
+	formulaCache.Store(formula, e)
+	return e, nil
+}
+
+// formulaItem 待计算的公式测点
+type formulaItem struct {
+	addr    modu.EAddr
+	derived bool
+	expr    *expr.Expr
+}
+
+// ApplyFormulas 在一个轮询周期的所有 ParseResponse 完成后计算公式，values 为本周期合并后的结果。
+// 测点的 Formula 以 raw 引用自身解析值，结果写回 Value，原值保存在 Raw；
+// dev.Calcs 中的计算测点只由公式得出，结果加入 values。
+// 公式按引用关系依次计算，引用的测点缺失或质量异常时该公式测点标记为失败。
+// 每个周期只应调用一次。
+func ApplyFormulas(dev *modu.EParser, values map[string]modu.ParseValue) error {
+	var errs modu.ParseErrors
+	var pending []formulaItem
+	waiting := make(map[string]bool)
+	add := func(addr modu.EAddr, derived bool) {
+		e, err := CompileFormula(addr.Formula)
+		if err != nil {
+			v, perr := Failed(addr, modu.QualityDecodeFailed, fmt.Errorf("公式错误: %w", err))
+			values[addr.MetricCode] = v
+			errs = append(errs, perr)
+			return
+		}
+		pending = append(pending, formulaItem{addr: addr, derived: derived, expr: e})
+		waiting[addr.MetricCode] = true
+	}
+	for _, v := range values {
+		if v.Addr.Formula == "" {
+			continue
+		}
+		if v.Quality != modu.QualityGood && v.Quality != modu.QualityOutOfRange {
+			continue
+		}
+		add(v.Addr, false)
+	}
+	for _, addr := range dev.Calcs {
+		if addr.Formula == "" {
+			continue
+		}
+		add(addr, true)
+	}
+
+	for len(pending) > 0 {
+		var rest []formulaItem
+		for _, item := range pending {
+			if !formulaReady(item, waiting) {
+				rest = append(rest, item)
+				continue
+			}
+			v, perr := evalFormula(item, values)
+			if perr != nil {
+				errs = append(errs, perr)
+			}
+			values[item.addr.MetricCode] = v
+			delete(waiting, item.addr.MetricCode)
+		}
+		if len(rest) == len(pending) {
+			for _, item := range rest {
+				v, perr := Failed(item.addr, modu.QualityDecodeFailed, errors.New("公式存在循环引用"))
+				values[item.addr.MetricCode] = v
+				errs = append(errs, perr)
+			}
+			break
+		}
+		pending = rest
+	}
+	return errs.Err()
+}
+
+// formulaReady 引用的其他公式测点都已计算
+func formulaReady(item formulaItem, waiting map[string]bool) bool {
+	for _, name := range item.expr.Vars() {
+		if name == rawVar && !item.derived {
+			continue
+		}
+		if name != item.addr.MetricCode && waiting[name] {
+			return false
+		}
+	}
+	return true
+}
+
+func evalFormula(item formulaItem, values map[string]modu.ParseValue) (modu.ParseValue, *modu.PointError) {
+	self := values[item.addr.MetricCode]
+	var badInput error
+	result, err := item.expr.Eval(func(name string) (float64, bool) {
+		if name == rawVar && !item.derived {
+			return self.Value, true
+		}
+		v, ok := values[name]
+		if !ok {
+			return 0, false
+		}
+		if v.Quality != modu.QualityGood && v.Quality != modu.QualityOutOfRange && badInput == nil {
+			badInput = fmt.Errorf("引用的测点%s质量异常: %s", name, v.Quality)
+		}
+		return v.Value, true
+	})
+	if badInput != nil {
+		return Failed(item.addr, modu.QualityExtractFailed, badInput)
+	}
+	var missing *expr.MissingError
+	if errors.As(err, &missing) {
+		return Failed(item.addr, modu.QualityExtractFailed, err)
+	}
+	if err != nil {
+		return Failed(item.addr, modu.QualityDecodeFailed, err)
+	}
+	v := self
+	if item.derived {
+		v = modu.ParseValue{Addr: item.addr}
+	}
+	v.Raw, v.Value, v.Kind = v.Value, result, modu.KindFloat
+	// 枚举与范围检查针对公式结果
+	v.Quality, v.Err = modu.QualityGood, nil
+	if v.Addr.EnumStr != "" {
+		v.Label, v.Severity = "", ""
+	}
+	v, aerr := ApplyEnum(v)
+	if aerr != nil {
+		return Failed(item.addr, modu.QualityDecodeFailed, aerr)
+	}
+	return CheckRange(v)
+}
@@ -1,17 +1,27 @@
 package parser
 
 import (
-	"encoding/hex"
+	"encoding/binary"
 	"errors"
+	"fmt"
 	"github.com/zoneBen/ProtoHub/modu"
 	"strconv"
+	"strings"
 )
 
+// HexParser 按 DataType/ByteOrder 解析定长字段，负载编码见 PayloadEncoding
 type HexParser struct {
 }
 
 func (p *HexParser) Extract(data []byte, dev *modu.EParser, addr modu.EAddr) ([]byte, error) {
-	if addr.Length > 0 {
+	if PayloadEncoding(dev, addr) == EncodingBase64 {
+		var err error
+		data, err = decodeBase64(data)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if addr.Length > 0 && addr.StartAt >= 0 {
 		end := addr.StartAt + addr.Length
 		if len(data) >= end {
 			return data[addr.StartAt:end], nil
@@ -20,25 +30,62 @@ func (p *HexParser) Extract(data []byte, dev *modu.EParser, addr modu.EAddr) ([]
 	return nil, errors.New("数据不足")
 }
 
+// Parse 解析数据，配置了 EnumStr 时填写枚举文本
 func (p *HexParser) Parse(buf []byte, dev *modu.EParser, addr modu.EAddr) (modu.ParseValue, error) {
+	v, err := p.parse(buf, dev, addr)
+	if err != nil {
+		return v, err
+	}
+	return ApplyEnum(v)
+}
+
+func (p *HexParser) parse(buf []byte, dev *modu.EParser, addr modu.EAddr) (modu.ParseValue, error) {
 	var parseValue modu.ParseValue
 	parseValue.Addr = addr
-	bytes, err := hex.DecodeString(string(buf))
+	encoding := PayloadEncoding(dev, addr)
+	if encoding == EncodingDecimal {
+		return p.parseDecimal(buf, addr)
+	}
+	bytes, err := payloadBytes(buf, encoding)
 	if err != nil {
 		return parseValue, err
 	}
+	if IsBitType(addr.DataType) {
+		parseValue, err = bitValue(bytes, addr)
+		if err != nil {
+			return parseValue, fmt.Errorf("%s%w", addr.MetricName, err)
+		}
+		return parseValue, nil
+	}
+	if IsTypedType(addr.DataType) {
+		parseValue, err = DecodeTyped(bytes, addr)
+		if err != nil {
+			return parseValue, fmt.Errorf("%s%w", addr.MetricName, err)
+		}
+		return parseValue, nil
+	}
 	var v float64
-	if addr.DataType == "BIN2INT" {
+	if addr.DataType == "MAP" {
+		// 数据为文本，按 ReMap 或 EnumStr 映射为数值
+		item, err := MapText(addr, trimString(string(bytes)))
+		if err != nil {
+			return parseValue, fmt.Errorf("%s%w", addr.MetricName, err)
+		}
+		v = item.Value
+		parseValue.Label, parseValue.Severity = item.Label, item.Severity
+	} else if addr.DataType == "BIN2INT" {
 		if addr.CutLength < 1 {
-			err = errors.New(addr.MetricName + "BIN2INT长度不足")
+			return parseValue, errors.New(addr.MetricName + "BIN2INT长度不足")
 		}
 		tmps := BytesToBinaryString(bytes)
 		st := len(tmps) - addr.CutOffset
+		if addr.CutOffset < 0 || st-addr.CutLength < 0 {
+			return parseValue, fmt.Errorf("%sBIN2INT截取位置超出数据范围: 共%d位, 偏移%d, 长度%d", addr.MetricName, len(tmps), addr.CutOffset, addr.CutLength)
+		}
 		t := tmps[st-addr.CutLength : st]
-		ti, err1 := strconv.ParseInt(string(t), 2, 64)
-		if err1 != nil {
-			err = err1
-			return parseValue, errors.New(addr.MetricName + "strconv.ParseInt 转换失败")
+		ti, err := strconv.ParseInt(string(t), 2, 64)
+		if err != nil {
+			return parseValue, fmt.Errorf("%sstrconv.ParseInt 转换失败: %w", addr.MetricName, err)
 		}
 		v = float64(ti)
 	} else if addr.DataType == "SIGN" {
@@ -53,7 +100,10 @@ func (p *HexParser) Parse(buf []byte, dev *modu.EParser, addr modu.EAddr) (modu.
 			return parseValue, errors.New("暂未实现，数值表示法长度大于2的数据。")
 		}
 	} else {
-		v = convertToFloat(bytes, addr.DataType, addr.ByteOrder)
+		v, err = convertToFloat(bytes, addr.DataType, addr.ByteOrder)
+		if err != nil {
+			return parseValue, fmt.Errorf("%s%w", addr.MetricName, err)
+		}
 	}
 	if addr.Scale != 0 {
 		v = v * addr.Scale
@@ -62,3 +112,39 @@ func (p *HexParser) Parse(buf []byte, dev *modu.EParser, addr modu.EAddr) (modu.
 	parseValue.Value = v
 	return parseValue, nil
 }
+
+// parseDecimal 解析 ASCII 十进制数值文本，非数值类型按文本解析
+func (p *HexParser) parseDecimal(buf []byte, addr modu.EAddr) (modu.ParseValue, error) {
+	parseValue := modu.ParseValue{Addr: addr}
+	text := strings.TrimSpace(string(buf))
+	if IsTypedType(addr.DataType) {
+		return parseTypedText([]byte(text), addr)
+	}
+	if addr.DataType == "MAP" {
+		item, err := MapText(addr, text)
+		if err != nil {
+			return parseValue, fmt.Errorf("%s%w", addr.MetricName, err)
+		}
+		parseValue.Value = item.Value
+		parseValue.Label, parseValue.Severity = item.Label, item.Severity
+		return parseValue, nil
+	}
+	v, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return parseValue, fmt.Errorf("%s十进制数值无效: %q", addr.MetricName, text)
+	}
+	if IsBitType(addr.DataType) {
+		var b [8]byte
+		binary.BigEndian.PutUint64(b[:], uint64(int64(v)))
+		parseValue, err = bitValue(b[:], addr)
+		if err != nil {
+			return parseValue, fmt.Errorf("%s%w", addr.MetricName, err)
+		}
+		return parseValue, nil
+	}
+	if addr.Scale != 0 {
+		v = v * addr.Scale
+	}
+	parseValue.Value = v + addr.Foundation
+	return parseValue, nil
+}
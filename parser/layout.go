@@ -0,0 +1,214 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/zoneBen/ProtoHub/modu"
+)
+
+// 单个重复结构的最大实例数，防止错误的数量字段导致展开失控
+const maxGroupCount = 1024
+
+// layoutScope 一个结构实例内已确定位置的测点与子结构
+type layoutScope struct {
+	parent *layoutScope
+	ends   map[string]int        // 测点或子结构名称 -> 结束位置
+	points map[string]modu.EAddr // 测点名称 -> 已定位的测点
+}
+
+func (s *layoutScope) lookupEnd(name string) (int, bool) {
+	for sc := s; sc != nil; sc = sc.parent {
+		if end, ok := sc.ends[name]; ok {
+			return end, true
+		}
+	}
+	return 0, false
+}
+
+func (s *layoutScope) lookupPoint(name string) (modu.EAddr, bool) {
+	for sc := s; sc != nil; sc = sc.parent {
+		if addr, ok := sc.points[name]; ok {
+			return addr, true
+		}
+	}
+	return modu.EAddr{}, false
+}
+
+// HasLayout 判断测点是否使用了重复结构或相对定位
+func HasLayout(addrs []modu.EAddr) bool {
+	for _, addr := range addrs {
+		if addr.Group != "" || addr.After != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// ExpandGroups 按响应数据计算重复结构与相对定位测点的实际位置，
+// 重复结构中的测点每个实例生成一个测点，MetricCode 以实例序号（从 1 开始）为后缀。
+// 数量字段由 par 从 data 中读取。
+func ExpandGroups(par Parser, data []byte, dev *modu.EParser, addrs []modu.EAddr) ([]modu.EAddr, error) {
+	if !HasLayout(addrs) {
+		return addrs, nil
+	}
+	all := make(map[string]modu.EGroup)
+	for _, g := range dev.Groups {
+		all[g.Name] = g
+	}
+	// 只展开本次测点实际用到的结构及其上级，其他命令的结构不参与定位
+	groups := make(map[string]modu.EGroup)
+	for _, addr := range addrs {
+		for name := addr.Group; name != ""; {
+			g, ok := all[name]
+			if !ok {
+				return nil, fmt.Errorf("测点%s的结构%s未定义", addr.MetricCode, name)
+			}
+			if _, ok := groups[name]; ok {
+				break
+			}
+			groups[name] = g
+			name = g.Parent
+		}
+	}
+	var out []modu.EAddr
+	_, err := layoutInstance(par, data, dev, addrs, groups, "", 0, nil, nil, &out)
+	return out, err
+}
+
+// layoutInstance 定位一个结构实例（name 为空时为顶层）内的测点与子结构，返回实例结束位置
+func layoutInstance(par Parser, data []byte, dev *modu.EParser, addrs []modu.EAddr, groups map[string]modu.EGroup,
+	name string, base int, index []int, parent *layoutScope, out *[]modu.EAddr) (int, error) {
+	scope := &layoutScope{parent: parent, ends: make(map[string]int), points: make(map[string]modu.EAddr)}
+	var members []modu.EAddr
+	for _, addr := range addrs {
+		if addr.Group == name {
+			members = append(members, addr)
+		}
+	}
+	var children []modu.EGroup
+	for _, g := range dev.Groups {
+		if _, ok := groups[g.Name]; ok && g.Parent == name {
+			children = append(children, g)
+		}
+	}
+
+	end := base
+	done := make(map[int]bool)
+	doneGroups := make(map[string]bool)
+	for len(done) < len(members) || len(doneGroups) < len(children) {
+		progress := false
+		for i, addr := range members {
+			if done[i] {
+				continue
+			}
+			start, ok := layoutStart(scope, base, addr.After, addr.StartAt)
+			if !ok {
+				continue
+			}
+			placed := addr
+			placed.StartAt = start
+			placed.Group = ""
+			placed.After = ""
+			if len(index) > 0 {
+				placed.MetricCode = addr.MetricCode + indexSuffix("_", index)
+				placed.MetricName = addr.MetricName + "#" + indexSuffix("-", index)[1:]
+			}
+			scope.ends[addr.MetricCode] = start + addr.Length
+			scope.points[addr.MetricCode] = placed
+			if start+addr.Length > end {
+				end = start + addr.Length
+			}
+			*out = append(*out, placed)
+			done[i] = true
+			progress = true
+		}
+		for _, g := range children {
+			if doneGroups[g.Name] {
+				continue
+			}
+			start, ok := layoutStart(scope, base, g.After, g.StartAt)
+			if !ok {
+				continue
+			}
+			count, ok, err := groupCount(par, data, dev, scope, g)
+			if err != nil {
+				return end, err
+			}
+			if !ok {
+				continue
+			}
+			cursor := start
+			for i := 0; i < count; i++ {
+				instEnd, err := layoutInstance(par, data, dev, addrs, groups, g.Name, cursor, append(append([]int(nil), index...), i+1), scope, out)
+				if err != nil {
+					return end, err
+				}
+				if instEnd < cursor+g.Stride {
+					instEnd = cursor + g.Stride
+				}
+				if instEnd <= cursor {
+					return end, fmt.Errorf("结构%s的实例长度为0", g.Name)
+				}
+				cursor = instEnd
+			}
+			scope.ends[g.Name] = cursor
+			if cursor > end {
+				end = cursor
+			}
+			doneGroups[g.Name] = true
+			progress = true
+		}
+		if !progress {
+			return end, errors.New("重复结构定位存在未定义或循环的引用")
+		}
+	}
+	return end, nil
+}
+
+// layoutStart 计算起始位，after 尚未定位时返回 false
+func layoutStart(scope *layoutScope, base int, after string, startAt int) (int, bool) {
+	if after == "" {
+		return base + startAt, true
+	}
+	end, ok := scope.lookupEnd(after)
+	if !ok {
+		return 0, false
+	}
+	return end + startAt, true
+}
+
+// groupCount 读取结构的实例数，数量字段尚未定位时返回 false
+func groupCount(par Parser, data []byte, dev *modu.EParser, scope *layoutScope, g modu.EGroup) (int, bool, error) {
+	if g.CountRef == "" {
+		return g.Count, true, nil
+	}
+	addr, ok := scope.lookupPoint(g.CountRef)
+	if !ok {
+		return 0, false, nil
+	}
+	buf, err := par.Extract(data, dev, addr)
+	if err != nil {
+		return 0, false, fmt.Errorf("结构%s读取数量字段%s失败: %w", g.Name, g.CountRef, err)
+	}
+	v, err := par.Parse(buf, dev, addr)
+	if err != nil {
+		return 0, false, fmt.Errorf("结构%s读取数量字段%s失败: %w", g.Name, g.CountRef, err)
+	}
+	count := int(v.Value)
+	if count < 0 || count > maxGroupCount {
+		return 0, false, fmt.Errorf("结构%s的数量%d超出范围", g.Name, count)
+	}
+	return count, true, nil
+}
+
+func indexSuffix(sep string, index []int) string {
+	var sb strings.Builder
+	for _, i := range index {
+		sb.WriteString(sep)
+		sb.WriteString(strconv.Itoa(i))
+	}
+	return sb.String()
+}
@@ -0,0 +1,130 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/zoneBen/ProtoHub/modu"
+)
+
+// EnumItem 数值与文本的一项映射
+type EnumItem struct {
+	Value    float64
+	Label    string
+	Severity string // 级别，如 major、critical，可为空
+}
+
+// Mapping 数值与文本的映射，EnumStr 与 ReMap 共用
+type Mapping []EnumItem
+
+// ByValue 按数值查找
+func (m Mapping) ByValue(v float64) (EnumItem, bool) {
+	for _, item := range m {
+		if item.Value == v {
+			return item, true
+		}
+	}
+	return EnumItem{}, false
+}
+
+// ByLabel 按文本查找
+func (m Mapping) ByLabel(label string) (EnumItem, bool) {
+	for _, item := range m {
+		if item.Label == label {
+			return item, true
+		}
+	}
+	return EnumItem{}, false
+}
+
+// 解析结果按配置字符串缓存，测点表在运行中不变
+var mappingCache sync.Map
+
+// ParseEnumStr 解析 "值:文本[:级别]" 以分号分隔的枚举，如 "0:正常;1:告警:major;2:故障:critical"
+func ParseEnumStr(s string) (Mapping, error) {
+	if m, ok := mappingCache.Load("enum:" + s); ok {
+		return m.(Mapping), nil
+	}
+	var m Mapping
+	for _, part := range strings.Split(s, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		fields := strings.SplitN(part, ":", 3)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("枚举项%q缺少文本", part)
+		}
+		v, err := strconv.ParseFloat(strings.TrimSpace(fields[0]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("枚举项%q的值无效", part)
+		}
+		item := EnumItem{Value: v, Label: strings.TrimSpace(fields[1])}
+		if len(fields) == 3 {
+			item.Severity = strings.TrimSpace(fields[2])
+		}
+		m = append(m, item)
+	}
+	mappingCache.Store("enum:"+s, m)
+	return m, nil
+}
+
+// ParseReMap 解析 ReMap 的 JSON 形式 {"文本": 值}
+func ParseReMap(s string) (Mapping, error) {
+	if m, ok := mappingCache.Load("remap:" + s); ok {
+		return m.(Mapping), nil
+	}
+	var jMap map[string]float64
+	if err := json.Unmarshal([]byte(s), &jMap); err != nil {
+		return nil, fmt.Errorf("MAP映射配置错误: %w", err)
+	}
+	m := make(Mapping, 0, len(jMap))
+	for label, v := range jMap {
+		m = append(m, EnumItem{Value: v, Label: label})
+	}
+	mappingCache.Store("remap:"+s, m)
+	return m, nil
+}
+
+// addrMapping 测点的映射，ReMap 优先，其次 EnumStr
+func addrMapping(addr modu.EAddr) (Mapping, error) {
+	if addr.ReMap != "" {
+		return ParseReMap(addr.ReMap)
+	}
+	if addr.EnumStr != "" {
+		return ParseEnumStr(addr.EnumStr)
+	}
+	return nil, fmt.Errorf("测点%s未配置ReMap或EnumStr", addr.MetricCode)
+}
+
+// MapText 将文本按测点映射转换为数值，用于 MAP 类型
+func MapText(addr modu.EAddr, text string) (EnumItem, error) {
+	m, err := addrMapping(addr)
+	if err != nil {
+		return EnumItem{}, err
+	}
+	item, ok := m.ByLabel(strings.TrimSpace(text))
+	if !ok {
+		return EnumItem{}, fmt.Errorf("MAP映射中没有%q", text)
+	}
+	return item, nil
+}
+
+// ApplyEnum 按 EnumStr 为数值填写文本与级别，未配置或未匹配时不修改；
+// 同时配置 ReMap 时 ReMap 将文本映射为数值，EnumStr 描述映射后的数值
+func ApplyEnum(v modu.ParseValue) (modu.ParseValue, error) {
+	if v.Addr.EnumStr == "" || v.Kind == modu.KindString || v.Label != "" && v.Addr.ReMap == "" {
+		return v, nil
+	}
+	m, err := ParseEnumStr(v.Addr.EnumStr)
+	if err != nil {
+		return v, err
+	}
+	if item, ok := m.ByValue(v.Value); ok {
+		v.Label, v.Severity = item.Label, item.Severity
+	}
+	return v, nil
+}
@@ -0,0 +1,52 @@
+package parser
+
+import (
+	"fmt"
+
+	"github.com/zoneBen/ProtoHub/modu"
+)
+
+// Failed 生成带质量标记的失败值
+func Failed(addr modu.EAddr, quality modu.Quality, err error) (modu.ParseValue, *modu.PointError) {
+	pe := &modu.PointError{MetricCode: addr.MetricCode, Quality: quality, Err: err}
+	return modu.ParseValue{Addr: addr, Quality: quality, Err: err}, pe
+}
+
+// FailAll 整个响应不可用（设备返回错误码、错误应答等）时将命令的全部测点标记为失败
+func FailAll(addrs []modu.EAddr, quality modu.Quality, err error) (map[string]modu.ParseValue, error) {
+	r := make(map[string]modu.ParseValue)
+	var errs modu.ParseErrors
+	for _, addr := range addrs {
+		v, perr := Failed(addr, quality, err)
+		errs = append(errs, perr)
+		r[addr.MetricCode] = v
+	}
+	return r, errs.Err()
+}
+
+// CheckRange 按测点的有效范围检查数值，超出时标记质量，数值保留；非数值类型不检查
+func CheckRange(v modu.ParseValue) (modu.ParseValue, *modu.PointError) {
+	addr := v.Addr
+	if v.Quality != modu.QualityGood || v.Kind != modu.KindFloat || addr.RangeMax <= addr.RangeMin {
+		return v, nil
+	}
+	if v.Value < addr.RangeMin || v.Value > addr.RangeMax {
+		v.Quality = modu.QualityOutOfRange
+		v.Err = fmt.Errorf("%g 超出范围 [%g, %g]", v.Value, addr.RangeMin, addr.RangeMax)
+		return v, &modu.PointError{MetricCode: addr.MetricCode, Quality: v.Quality, Err: v.Err}
+	}
+	return v, nil
+}
+
+// Decode 提取并解析一个测点，失败时返回带质量标记的值与错误
+func Decode(par Parser, data []byte, dev *modu.EParser, addr modu.EAddr) (modu.ParseValue, *modu.PointError) {
+	buf, err := par.Extract(data, dev, addr)
+	if err != nil {
+		return Failed(addr, modu.QualityExtractFailed, err)
+	}
+	v, err := par.Parse(buf, dev, addr)
+	if err != nil {
+		return Failed(addr, modu.QualityDecodeFailed, err)
+	}
+	return CheckRange(v)
+}
@@ -1,7 +1,7 @@
 package parser
 
 import (
-	"encoding/json"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"github.com/zoneBen/ProtoHub/modu"
@@ -20,20 +20,42 @@ func (p *SimpleParser) Extract(data []byte, dev *modu.EParser, addr modu.EAddr)
 	if separator == "空格" {
 		separator = " "
 	}
+	if addr.Line > 0 {
+		lines := TextLines(data)
+		if addr.Line > len(lines) {
+			return nil, fmt.Errorf("数据不足: 第%d行不存在, 共%d行", addr.Line, len(lines))
+		}
+		data = []byte(lines[addr.Line-1])
+	}
 	strData := strings.Replace(string(data), "\r", "", -1)
 	tmps := strings.Split(strData, separator)
 	maxlen := len(tmps)
 	var valTmp string
-	//优先根据测点Index
-	if addr.MetricIndex > 0 && addr.MetricIndex <= maxlen {
+	if addr.Pattern != "" || addr.Key != "" {
+		var err error
+		if addr.Pattern != "" {
+			valTmp, err = extractPattern(strData, addr)
+		} else {
+			valTmp, err = extractKeyValue(strData, separator, addr)
+		}
+		if err != nil {
+			return nil, err
+		}
+	} else if addr.MetricIndex > 0 && addr.MetricIndex <= maxlen {
+		//优先根据测点Index
 		valTmp = tmps[addr.MetricIndex-1]
 	} else {
 		if addr.Length > 0 {
+			if addr.StartAt < 0 || addr.StartAt+addr.Length > len(data) {
+				return nil, fmt.Errorf("数据不足: 需要%d字符, 实际%d字符", addr.StartAt+addr.Length, len(data))
+			}
 			valTmp = string(data)[addr.StartAt : addr.StartAt+addr.Length]
+		} else if addr.MetricIndex > 0 {
+			return nil, fmt.Errorf("数据不足: 第%d个字段不存在, 共%d个", addr.MetricIndex, maxlen)
 		}
 	}
 	// 第一个测点需要排除前缀
-	if addr.MetricIndex == 1 {
+	if addr.MetricIndex == 1 && addr.Line <= 1 && addr.Pattern == "" && addr.Key == "" {
 		_, _, _, revPre, _ := getQRealCommand(dev, addr)
 		if strings.HasPrefix(valTmp, revPre) {
 			valTmp = valTmp[len(revPre):]
@@ -46,22 +68,50 @@ func (p *SimpleParser) Extract(data []byte, dev *modu.EParser, addr modu.EAddr)
 			valTmp = valTmp[addr.CutOffset : addr.CutOffset+addr.CutLength]
 		}
 	}
-
+	if valTmp == "" {
+		return nil, errors.New("未提取到数据")
+	}
 	return []byte(valTmp), nil
 }
 
+// Parse 解析文本数据，配置了 EnumStr 时填写枚举文本
 func (p *SimpleParser) Parse(buf []byte, dev *modu.EParser, addr modu.EAddr) (modu.ParseValue, error) {
+	v, err := p.parse(buf, dev, addr)
+	if err != nil {
+		return v, err
+	}
+	return ApplyEnum(v)
+}
+
+func (p *SimpleParser) parse(buf []byte, dev *modu.EParser, addr modu.EAddr) (modu.ParseValue, error) {
 	var parseValue modu.ParseValue
 	parseValue.Addr = addr
+	if IsTypedType(addr.DataType) {
+		return parseTypedText(buf, addr)
+	}
+	if IsBitType(addr.DataType) {
+		data, n, err := binaryText(string(buf))
+		if err != nil {
+			return parseValue, err
+		}
+		// 文本按字符编号，未指定字宽时整段文本为一个字
+		bitAddr := addr
+		if bitAddr.BitWidth <= 0 {
+			bitAddr.BitWidth = n
+		}
+		parseValue, err = bitValue(data, bitAddr)
+		parseValue.Addr = addr
+		return parseValue, err
+	}
 	valTmp := string(buf)
 	var err error
 	var v float64
 	if valTmp != "" {
 		var valFloat float64
 		switch addr.DataType {
-		case "FLOAT":
+		case "", "FLOAT":
 			{
-				// 浮点数提取强化兼容性对于包含字符的自动过滤处理
+				// 浮点数提取强化兼容性对于包含字符的自动过滤处理，未配置数据类型时同样按数值解析
 				valFloat, err = extractNumber(valTmp)
 				if err != nil {
 					log.Println("coverValue() FLOAT ParseFloat error ", err.Error())
@@ -70,22 +120,18 @@ func (p *SimpleParser) Parse(buf []byte, dev *modu.EParser, addr modu.EAddr) (mo
 			}
 		case "MAP":
 			{
-				var jMap map[string]float64
-				if addr.ReMap != "" {
-					err = json.Unmarshal([]byte(addr.ReMap), &jMap)
-					if err == nil {
-						if vTmp, ok := jMap[valTmp]; ok {
-							valFloat = vTmp
-						}
-					} else {
-						log.Println("coverValue() MAP json.Unmarshal error ", err.Error())
-					}
+				var item EnumItem
+				item, err = MapText(addr, valTmp)
+				if err == nil {
+					valFloat = item.Value
+					parseValue.Label, parseValue.Severity = item.Label, item.Severity
 				}
 				break
 			}
 		case "BIN2INT":
 			{
-				num, err := strconv.ParseInt(valTmp, 2, 64)
+				var num int64
+				num, err = strconv.ParseInt(valTmp, 2, 64)
 				if err == nil {
 					valFloat = float64(num)
 				} else {
@@ -95,7 +141,8 @@ func (p *SimpleParser) Parse(buf []byte, dev *modu.EParser, addr modu.EAddr) (mo
 			}
 		case "HEX2INT":
 			{
-				num, err := strconv.ParseInt(valTmp, 16, 64)
+				var num int64
+				num, err = strconv.ParseInt(valTmp, 16, 64)
 				if err == nil {
 					valFloat = float64(num)
 				} else {
@@ -103,6 +150,21 @@ func (p *SimpleParser) Parse(buf []byte, dev *modu.EParser, addr modu.EAddr) (mo
 				}
 				break
 			}
+		default:
+			if !IsBCDType(addr.DataType) {
+				err = fmt.Errorf("不支持的数据类型: %s", addr.DataType)
+				break
+			}
+			// BCD 以十六进制文本传输，如 "1234"
+			digits := strings.TrimSpace(valTmp)
+			if len(digits)%2 != 0 {
+				digits = "0" + digits
+			}
+			var bytes []byte
+			bytes, err = hex.DecodeString(digits)
+			if err == nil {
+				valFloat, err = convertToFloat(bytes, addr.DataType, addr.ByteOrder)
+			}
 		}
 		if addr.Scale == 0.0 {
 			addr.Scale = 1.0
@@ -117,6 +179,19 @@ func (p *SimpleParser) Parse(buf []byte, dev *modu.EParser, addr modu.EAddr) (mo
 	return parseValue, err
 }
 
+// TextLines 按 \r\n、\n 或 \r 分行，忽略空行
+func TextLines(data []byte) []string {
+	s := strings.Replace(string(data), "\r\n", "\n", -1)
+	s = strings.Replace(s, "\r", "\n", -1)
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
 func getQRealCommand(dev *modu.EParser, eAddr modu.EAddr) (realCommand string, sendPre, sendSuf, revPre, revSuf string) {
 	if dev.Dev.SendPre != "" {
 		sendPre = replacementSpecialCharacters(dev.Dev.SendPre)
@@ -163,13 +238,14 @@ func replacementSpecialCharacters(oldVal string) (val string) {
 	return
 }
 
+// 数值提取的正则只编译一次
+var numberPattern = regexp.MustCompile(`[-+]?\d+(\.\d+)?`)
+
 // extractNumber 尝试从字符串中提取第一个有效的浮点数或整型数
 func extractNumber(input string) (float64, error) {
-	re := regexp.MustCompile(`[-+]?\d+(\.\d+)?`)
-	// 查找所有匹配项
-	matches := re.FindAllString(input, -1)
-	if len(matches) > 0 {
-		return strconv.ParseFloat(matches[0], 64)
+	match := numberPattern.FindString(input)
+	if match != "" {
+		return strconv.ParseFloat(match, 64)
 	}
 	// 如果没有找到有效的数字，则返回错误
 	return 0, fmt.Errorf("no valid number found in input string")
@@ -0,0 +1,79 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+
+	"github.com/zoneBen/ProtoHub/modu"
+)
+
+// 测点表中的正则在运行中不变，编译结果按原文缓存
+var patternCache sync.Map
+
+// compilePattern 编译并缓存正则
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if re, ok := patternCache.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("正则%q无效: %w", pattern, err)
+	}
+	patternCache.Store(pattern, re)
+	return re, nil
+}
+
+// extractPattern 按 EAddr.Pattern 提取，MetricIndex 大于 0 时取第 MetricIndex 个匹配。
+// 取值分组依次为：与 MetricCode 同名的命名分组、名为 value 的分组、第一个分组、整个匹配。
+func extractPattern(text string, addr modu.EAddr) (string, error) {
+	re, err := compilePattern(addr.Pattern)
+	if err != nil {
+		return "", err
+	}
+	n := 1
+	if addr.MetricIndex > 0 {
+		n = addr.MetricIndex
+	}
+	matches := re.FindAllStringSubmatch(text, n)
+	if len(matches) < n {
+		return "", fmt.Errorf("正则%q未匹配到第%d项", addr.Pattern, n)
+	}
+	match := matches[n-1]
+	group := -1
+	for _, name := range []string{addr.MetricCode, "value"} {
+		if i := re.SubexpIndex(name); name != "" && i > 0 {
+			group = i
+			break
+		}
+	}
+	if group < 0 {
+		group = 0
+		if re.NumSubexp() > 0 {
+			group = 1
+		}
+	}
+	return match[group], nil
+}
+
+// extractKeyValue 从 "key=value"、"key: value" 形式的文本中取 EAddr.Key 的值，
+// 值为双引号字符串或到分隔符（空白、逗号、分号、& 及设备分隔符）为止的内容，键区分大小写
+func extractKeyValue(text, separator string, addr modu.EAddr) (string, error) {
+	stops := `\s,;&`
+	if separator != "" && separator != " " && len([]rune(separator)) == 1 {
+		stops += regexp.QuoteMeta(separator)
+	}
+	pattern := `(?:^|[` + stops + `])` + regexp.QuoteMeta(addr.Key) + `\s*[=:]\s*(?:"([^"]*)"|([^` + stops + `]*))`
+	re, err := compilePattern(pattern)
+	if err != nil {
+		return "", err
+	}
+	match := re.FindStringSubmatch(text)
+	if match == nil {
+		return "", fmt.Errorf("未找到键%s", addr.Key)
+	}
+	if match[1] != "" {
+		return match[1], nil
+	}
+	return match[2], nil
+}
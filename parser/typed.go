@@ -0,0 +1,181 @@
+package parser
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/zoneBen/ProtoHub/modu"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// IsTypedType 判断是否为非数值数据类型：
+//
+//	ASCII、GBK、UTF16（ByteOrder 为 BA 时小端）、UTF16LE  字符串，去除末尾的 0x00 与空格
+//	BCDTIME   BCD 日期时间 YYMMDDhhmmss（6 字节）或 YYYYMMDDhhmmss（7 字节），ByteOrder 为 BA 时逆序
+//	UNIXTIME  Unix 秒，4 或 8 字节无符号整数
+//	YDTTIME   YD/T 1363 日期时间：年(2 字节，高位在前) 月 日 时 分 秒
+//	BOOL      非 0 为真
+func IsTypedType(dataType string) bool {
+	switch strings.ToUpper(dataType) {
+	case "ASCII", "GBK", "UTF16", "UTF16LE", "BCDTIME", "UNIXTIME", "YDTTIME", "BOOL":
+		return true
+	}
+	return false
+}
+
+// DecodeTyped 解码非数值数据类型
+func DecodeTyped(data []byte, addr modu.EAddr) (modu.ParseValue, error) {
+	v := modu.ParseValue{Addr: addr}
+	var err error
+	switch strings.ToUpper(addr.DataType) {
+	case "ASCII":
+		v.Kind, v.Str = modu.KindString, trimString(string(data))
+	case "GBK":
+		var b []byte
+		b, err = simplifiedchinese.GBK.NewDecoder().Bytes(data)
+		v.Kind, v.Str = modu.KindString, trimString(string(b))
+	case "UTF16", "UTF16LE":
+		if len(data)%2 != 0 {
+			return v, fmt.Errorf("UTF16数据长度%d不是偶数", len(data))
+		}
+		var order binary.ByteOrder = binary.BigEndian
+		if strings.EqualFold(addr.DataType, "UTF16LE") || addr.ByteOrder == "BA" {
+			order = binary.LittleEndian
+		}
+		units := make([]uint16, len(data)/2)
+		for i := range units {
+			units[i] = order.Uint16(data[i*2:])
+		}
+		v.Kind, v.Str = modu.KindString, trimString(string(utf16.Decode(units)))
+	case "BCDTIME":
+		v.Time, err = decodeBCDTime(data, addr.ByteOrder)
+		v.Kind = modu.KindTime
+	case "UNIXTIME":
+		if len(data) != 4 && len(data) != 8 {
+			return v, fmt.Errorf("UNIXTIME需要4或8字节, 实际%d字节", len(data))
+		}
+		var b []byte
+		b, err = toBigEndian(data, addr.ByteOrder)
+		if err == nil {
+			v.Kind, v.Time = modu.KindTime, time.Unix(int64(beUint(b)), 0)
+		}
+	case "YDTTIME":
+		if len(data) < 7 {
+			return v, fmt.Errorf("YDTTIME需要7字节, 实际%d字节", len(data))
+		}
+		year := int(binary.BigEndian.Uint16(data))
+		v.Time, err = makeTime(year, int(data[2]), int(data[3]), int(data[4]), int(data[5]), int(data[6]))
+		v.Kind = modu.KindTime
+	case "BOOL":
+		v.Kind, v.Bool = modu.KindBool, false
+		for _, b := range data {
+			if b != 0 {
+				v.Bool = true
+				break
+			}
+		}
+	default:
+		return v, fmt.Errorf("不支持的数据类型: %s", addr.DataType)
+	}
+	if err != nil {
+		return v, err
+	}
+	setTypedValue(&v)
+	return v, nil
+}
+
+// parseTypedText 解析文本协议中的非数值类型，字符串直接取原文，
+// 布尔与 Unix 时间按文本解析，其余类型按十六进制文本解码
+func parseTypedText(text []byte, addr modu.EAddr) (modu.ParseValue, error) {
+	v := modu.ParseValue{Addr: addr}
+	s := strings.TrimSpace(string(text))
+	switch strings.ToUpper(addr.DataType) {
+	case "ASCII", "GBK", "UTF16", "UTF16LE":
+		return DecodeTyped(text, addr)
+	case "BOOL":
+		switch strings.ToLower(s) {
+		case "1", "true", "on", "yes":
+			v.Bool = true
+		case "0", "false", "off", "no":
+		default:
+			return v, fmt.Errorf("无法解析为布尔值: %q", s)
+		}
+		v.Kind = modu.KindBool
+		setTypedValue(&v)
+		return v, nil
+	case "UNIXTIME":
+		sec, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return v, err
+		}
+		v.Kind, v.Time = modu.KindTime, time.Unix(sec, 0)
+		setTypedValue(&v)
+		return v, nil
+	}
+	if len(s)%2 != 0 {
+		s = "0" + s
+	}
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		return v, err
+	}
+	return DecodeTyped(data, addr)
+}
+
+// setTypedValue 同步数值，供只读取 Value 的使用方
+func setTypedValue(v *modu.ParseValue) {
+	switch v.Kind {
+	case modu.KindTime:
+		v.Value = float64(v.Time.Unix())
+	case modu.KindBool:
+		v.Value = 0
+		if v.Bool {
+			v.Value = 1
+		}
+	case modu.KindString:
+		v.Value = 0
+	}
+}
+
+func trimString(s string) string {
+	return strings.TrimRight(s, "\x00 ")
+}
+
+// decodeBCDTime BCD 编码的日期时间，6 字节年份为 2000 年起
+func decodeBCDTime(data []byte, byteOrder string) (time.Time, error) {
+	if len(data) != 6 && len(data) != 7 {
+		return time.Time{}, fmt.Errorf("BCDTIME需要6或7字节, 实际%d字节", len(data))
+	}
+	b, err := toBigEndian(data, byteOrder)
+	if err != nil {
+		return time.Time{}, err
+	}
+	fields := make([]int, len(b))
+	for i, x := range b {
+		if x>>4 > 9 || x&0x0F > 9 {
+			return time.Time{}, fmt.Errorf("BCDTIME包含非十进制数字: %X", b)
+		}
+		fields[i] = int(x>>4)*10 + int(x&0x0F)
+	}
+	year := 2000 + fields[0]
+	if len(fields) == 7 {
+		year = fields[0]*100 + fields[1]
+		fields = fields[1:]
+	}
+	return makeTime(year, fields[1], fields[2], fields[3], fields[4], fields[5])
+}
+
+// makeTime 按设备本地时间构造，拒绝越界的字段，避免 time.Date 自动进位
+func makeTime(year, month, day, hour, min, sec int) (time.Time, error) {
+	t := time.Date(year, time.Month(month), day, hour, min, sec, 0, time.Local)
+	if t.Year() != year || int(t.Month()) != month || t.Day() != day ||
+		t.Hour() != hour || t.Minute() != min || t.Second() != sec {
+		return time.Time{}, fmt.Errorf("无效的日期时间: %04d-%02d-%02d %02d:%02d:%02d", year, month, day, hour, min, sec)
+	}
+	return t, nil
+}
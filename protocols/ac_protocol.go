@@ -6,6 +6,7 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"github.com/zoneBen/ProtoHub/checksum"
 	"github.com/zoneBen/ProtoHub/core"
 	"github.com/zoneBen/ProtoHub/modu"
 	"github.com/zoneBen/ProtoHub/parser"
@@ -21,6 +22,10 @@ type ACProtocol struct {
 // GenerateCommands 生成命令键与内容的映射
 func (p *ACProtocol) GenerateCommands(dev *modu.EParser) (map[string][]byte, error) {
 	commands := make(map[string][]byte)
+	err := p.ExpandPreset(dev)
+	if err != nil {
+		return nil, err
+	}
 	devCid1, err := getByte(dev.Dev.Cid1)
 	if err != nil {
 		log.Println("设备CID1未设置或设置错误")
@@ -75,7 +80,7 @@ func getByte(s string) (byte, error) {
 	}
 	data, err := hex.DecodeString(s)
 	if err != nil {
-		return 0, errors.New(fmt.Sprintf("Error decoding hex string:%w", err))
+		return 0, fmt.Errorf("Error decoding hex string:%w", err)
 	}
 	return data[0], nil
 }
@@ -83,11 +88,31 @@ func getByte(s string) (byte, error) {
 func getBytes(s string) ([]byte, error) {
 	data, err := hex.DecodeString(s)
 	if err != nil {
-		return nil, errors.New(fmt.Sprintf("Error decoding hex string:%w", err))
+		return nil, fmt.Errorf("Error decoding hex string:%w", err)
 	}
 	return data, nil
 }
 
+// applyScale 按测点的缩放与偏置换算数值
+func applyScale(v float64, addr modu.EAddr) float64 {
+	if addr.Scale != 0 {
+		v = v * addr.Scale
+	}
+	return v + addr.Foundation
+}
+
+// 电总帧校验：SOI 之后的 ASCII 字符累加和取反加 1，以 4 位十六进制文本表示
+var ydtChecksum = &checksum.Spec{Algorithm: mustChecksum(checksum.YDT1363), Start: 1, Order: checksum.OrderHex}
+
+// mustChecksum 获取内置校验算法
+func mustChecksum(name string) checksum.Checksum {
+	alg, err := checksum.Get(name)
+	if err != nil {
+		panic(err)
+	}
+	return alg
+}
+
 // buildFrame 构建协议帧
 func buildFrame(soi byte, ver byte, adr byte, cid1 byte, cid2 byte, info []byte, eoi byte) ([]byte, error) {
 	lenID := uint16(len(info) * 2)
@@ -96,7 +121,6 @@ func buildFrame(soi byte, ver byte, adr byte, cid1 byte, cid2 byte, info []byte,
 	seg3 := lenID & 0x0F
 	lCheckSum := ^(seg1+seg2+seg3)&0x0F + 1
 	length := (uint16(lCheckSum) << 12) | lenID
-	var sum uint16
 
 	// 组装完整帧
 	frame := []byte{soi}
@@ -110,13 +134,12 @@ func buildFrame(soi byte, ver byte, adr byte, cid1 byte, cid2 byte, info []byte,
 	if lenID > 0 {
 		body = append(body, bytesToASCII(info)...)
 	}
-	for _, b := range body {
-		sum += uint16(b)
-	}
-	chkSum := ^sum + 1 // 取反加1
 	frame = append(frame, body...)
-	sunData := bytesToASCII(Uint16ToBytes(chkSum, false))
-	frame = append(frame, sunData...)
+	// 校验和覆盖 SOI 之后的全部 ASCII 字符
+	frame, err := ydtChecksum.Append(frame)
+	if err != nil {
+		return nil, err
+	}
 	frame = append(frame, eoi)
 	return frame, nil
 }
@@ -208,14 +231,21 @@ func (p *ACProtocol) GetCommandAddrs(dev *modu.EParser, commandKey string) (addr
 func (p *ACProtocol) ParseResponse(data []byte, dev *modu.EParser, addrs []modu.EAddr) (map[string]modu.ParseValue, error) {
 	var par parser.HexParser
 	var r = make(map[string]modu.ParseValue)
+	addrs, err := parser.ExpandGroups(&par, data, dev, addrs)
+	if err != nil {
+		return r, err
+	}
+	addrs, err = parser.ExpandBits(addrs)
+	if err != nil {
+		return r, err
+	}
+	var errs modu.ParseErrors
 	for _, addr := range addrs {
-		extract, err := par.Extract(data, dev, addr)
-		if err != nil {
-			log.Printf("提取数据失败")
-			continue
+		v, perr := parser.Decode(&par, data, dev, addr)
+		if perr != nil {
+			errs = append(errs, perr)
 		}
-		v, err := par.Parse(extract, dev, addr)
 		r[addr.MetricCode] = v
 	}
-	return r, nil
+	return r, errs.Err()
 }
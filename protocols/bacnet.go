@@ -0,0 +1,778 @@
+package protocols
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/zoneBen/ProtoHub/core"
+	"github.com/zoneBen/ProtoHub/modu"
+	"github.com/zoneBen/ProtoHub/parser"
+)
+
+// BACnetProtocol BACnet/IP 采集协议。
+// EAddr.Command 为 "对象类型:实例号"，类型可写名称（analog-input、AI）或编号；
+// EAddr.CommandExtra 为属性名或编号，缺省 present-value，数组属性写作 "priority-array[8]"。
+type BACnetProtocol struct {
+	MaxProps int           // 单个 ReadPropertyMultiple 最多读取的属性数，默认 16；为 1 时使用 ReadProperty
+	Timeout  time.Duration // 单次请求超时，默认 3 秒
+}
+
+const (
+	bvlcType             = 0x81
+	bvlcUnicastNPDU      = 0x0A
+	bvlcBroadcastNPDU    = 0x0B
+	bacnetPropPresentVal = 85
+	bacnetNoIndex        = math.MaxUint32
+
+	apduConfirmedReq   = 0x00
+	apduUnconfirmedReq = 0x10
+	apduSimpleAck      = 0x20
+	apduComplexAck     = 0x30
+	apduError          = 0x50
+	apduReject         = 0x60
+	apduAbort          = 0x70
+
+	serviceReadProperty     = 0x0C
+	serviceReadPropMultiple = 0x0E
+	serviceUnconfirmedIAm   = 0x00
+	serviceUnconfirmedWhoIs = 0x08
+	bacnetDefaultPort       = 47808
+	bacnetMaxAPDUAccepted   = 0x05 // 最大 APDU 1476 字节，不分段
+	bacnetDefaultMaxProps   = 16
+)
+
+var bacnetObjectTypes = map[string]uint32{
+	"analog-input": 0, "ai": 0,
+	"analog-output": 1, "ao": 1,
+	"analog-value": 2, "av": 2,
+	"binary-input": 3, "bi": 3,
+	"binary-output": 4, "bo": 4,
+	"binary-value": 5, "bv": 5,
+	"device":            8,
+	"multi-state-input": 13, "msi": 13,
+	"multi-state-output": 14, "mso": 14,
+	"multi-state-value": 19, "msv": 19,
+	"accumulator": 23,
+}
+
+var bacnetProperties = map[string]uint32{
+	"description":    28,
+	"event-state":    36,
+	"object-name":    77,
+	"out-of-service": 81,
+	"present-value":  85,
+	"priority-array": 87,
+	"reliability":    103,
+	"status-flags":   111,
+	"units":          117,
+}
+
+var bacnetInvokeID uint32
+
+func nextBACnetInvokeID() byte {
+	return byte(atomic.AddUint32(&bacnetInvokeID, 1))
+}
+
+// bacnetRef 一个对象属性引用
+type bacnetRef struct {
+	ObjType  uint32
+	Instance uint32
+	Property uint32
+	Index    uint32
+}
+
+func (r bacnetRef) key() string {
+	return fmt.Sprintf("%d:%d:%d:%d", r.ObjType, r.Instance, r.Property, r.Index)
+}
+
+func (r bacnetRef) objectID() uint32 {
+	return r.ObjType<<22 | r.Instance&0x3FFFFF
+}
+
+// parseBACnetRef 解析测点的对象与属性
+func parseBACnetRef(addr modu.EAddr) (bacnetRef, error) {
+	ref := bacnetRef{Property: bacnetPropPresentVal, Index: bacnetNoIndex}
+	parts := strings.Split(strings.TrimSpace(addr.Command), ":")
+	if len(parts) != 2 {
+		return ref, fmt.Errorf("bacnet object %q must be type:instance", addr.Command)
+	}
+	t, err := lookupBACnetName(parts[0], bacnetObjectTypes)
+	if err != nil {
+		return ref, err
+	}
+	inst, err := strconv.ParseUint(strings.TrimSpace(parts[1]), 10, 32)
+	if err != nil || inst > 0x3FFFFF {
+		return ref, fmt.Errorf("bacnet object %q: invalid instance", addr.Command)
+	}
+	ref.ObjType, ref.Instance = t, uint32(inst)
+
+	prop := strings.TrimSpace(addr.CommandExtra)
+	if i := strings.Index(prop, "["); i > 0 && strings.HasSuffix(prop, "]") {
+		idx, err := strconv.ParseUint(prop[i+1:len(prop)-1], 10, 32)
+		if err != nil {
+			return ref, fmt.Errorf("bacnet property %q: invalid index", prop)
+		}
+		ref.Index = uint32(idx)
+		prop = prop[:i]
+	}
+	if prop != "" {
+		if ref.Property, err = lookupBACnetName(prop, bacnetProperties); err != nil {
+			return ref, err
+		}
+	}
+	return ref, nil
+}
+
+func lookupBACnetName(s string, names map[string]uint32) (uint32, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if v, ok := names[s]; ok {
+		return v, nil
+	}
+	v, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("unknown bacnet name %q", s)
+	}
+	return uint32(v), nil
+}
+
+func (p *BACnetProtocol) maxProps() int {
+	if p.MaxProps > 0 {
+		return p.MaxProps
+	}
+	return bacnetDefaultMaxProps
+}
+
+func (p *BACnetProtocol) timeout() time.Duration {
+	if p.Timeout > 0 {
+		return p.Timeout
+	}
+	return 3 * time.Second
+}
+
+// getBatches 按测点顺序将属性引用分批
+func (p *BACnetProtocol) getBatches(dev *modu.EParser) (map[string]int, [][]bacnetRef) {
+	index := make(map[string]int)
+	var batches [][]bacnetRef
+	for _, addr := range dev.Addrs {
+		ref, err := parseBACnetRef(addr)
+		if err != nil {
+			continue
+		}
+		if _, ok := index[ref.key()]; ok {
+			continue
+		}
+		if len(batches) == 0 || len(batches[len(batches)-1]) >= p.maxProps() {
+			batches = append(batches, nil)
+		}
+		index[ref.key()] = len(batches) - 1
+		batches[len(batches)-1] = append(batches[len(batches)-1], ref)
+	}
+	return index, batches
+}
+
+// GenerateCommands 生成命令键与内容的映射
+func (p *BACnetProtocol) GenerateCommands(dev *modu.EParser) (map[string][]byte, error) {
+	commands := make(map[string][]byte)
+	for _, addr := range dev.Addrs {
+		if _, err := parseBACnetRef(addr); err != nil {
+			log.Printf("测点%s配置错误: %v", addr.MetricName, err)
+			return nil, err
+		}
+	}
+	_, batches := p.getBatches(dev)
+	for i, refs := range batches {
+		var apdu []byte
+		if len(refs) == 1 && p.maxProps() == 1 {
+			apdu = encodeReadProperty(nextBACnetInvokeID(), refs[0])
+		} else {
+			apdu = encodeReadPropertyMultiple(nextBACnetInvokeID(), refs)
+		}
+		commands[fmt.Sprintf("bacnet@%d", i)] = bacnetFrame(bvlcUnicastNPDU, []byte{0x01, 0x04}, apdu)
+	}
+	return commands, nil
+}
+
+func (p *BACnetProtocol) GenerateKey(dev *modu.EParser, addr modu.EAddr) string {
+	index, _ := p.getBatches(dev)
+	return bacnetKey(index, addr)
+}
+
+// bacnetKey 由 getBatches 返回的分批索引生成命令键
+func bacnetKey(index map[string]int, addr modu.EAddr) string {
+	ref, err := parseBACnetRef(addr)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("bacnet@%d", index[ref.key()])
+}
+
+// GetCommandAddrs 获取命令对应的测点
+func (p *BACnetProtocol) GetCommandAddrs(dev *modu.EParser, commandKey string) (addrs []modu.EAddr) {
+	index, _ := p.getBatches(dev)
+	for _, addr := range dev.Addrs {
+		if bacnetKey(index, addr) == commandKey {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+// Send 发送确认请求并等待 invoke-id 匹配的应答
+func (p *BACnetProtocol) Send(transport core.Transport, sendBuf []byte, dev *modu.EParser) ([]byte, error) {
+	apdu, err := bacnetAPDU(sendBuf)
+	if err != nil || len(apdu) < 4 {
+		return nil, errors.New("invalid bacnet request")
+	}
+	invokeID := apdu[2]
+
+	err = transport.Connect()
+	if err != nil {
+		log.Println("BACnetProtocol Send connect err:", err)
+		return nil, err
+	}
+	defer transport.Close()
+
+	err = transport.Write(sendBuf)
+	if err != nil {
+		return nil, fmt.Errorf("write failed: %w", err)
+	}
+	endTime := time.Now().Add(p.timeout())
+	for time.Now().Before(endTime) {
+		ctx, cancel := context.WithDeadline(context.Background(), endTime)
+		data, err := transport.ReadWithContext(ctx)
+		cancel()
+		if err != nil {
+			if errors.Is(err, context.DeadlineExceeded) {
+				break
+			}
+			return nil, fmt.Errorf("read error: %w", err)
+		}
+		resp, err := bacnetAPDU(data)
+		if err != nil || len(resp) < 2 || resp[0]&0xF0 == apduConfirmedReq || resp[0]&0xF0 == apduUnconfirmedReq {
+			continue
+		}
+		if resp[1] == invokeID {
+			return data, nil
+		}
+	}
+	return nil, fmt.Errorf("bacnet timeout after %v", p.timeout())
+}
+
+// ParseResponse 解析 ReadProperty/ReadPropertyMultiple 应答
+func (p *BACnetProtocol) ParseResponse(data []byte, dev *modu.EParser, addrs []modu.EAddr) (map[string]modu.ParseValue, error) {
+	var r = make(map[string]modu.ParseValue)
+	apdu, err := bacnetAPDU(data)
+	if err != nil {
+		return parser.FailAll(addrs, modu.QualityExtractFailed, err)
+	}
+	// Error、Reject、Abort 应答同样返回错误，请求的测点全部标记为失败
+	values, err := decodeBACnetAck(apdu)
+	if err != nil {
+		return parser.FailAll(addrs, modu.QualityExtractFailed, err)
+	}
+	var errs modu.ParseErrors
+	for _, addr := range addrs {
+		v, perr := bacnetDecode(values, addr)
+		if perr != nil {
+			errs = append(errs, perr)
+		}
+		r[addr.MetricCode] = v
+	}
+	return r, errs.Err()
+}
+
+func bacnetDecode(values map[string]bacnetValue, addr modu.EAddr) (modu.ParseValue, *modu.PointError) {
+	ref, err := parseBACnetRef(addr)
+	if err != nil {
+		return parser.Failed(addr, modu.QualityExtractFailed, err)
+	}
+	val, ok := values[ref.key()]
+	if !ok {
+		return parser.Failed(addr, modu.QualityExtractFailed, errors.New("应答中没有该属性"))
+	}
+	if val.err != nil {
+		return parser.Failed(addr, modu.QualityExtractFailed, val.err)
+	}
+	v, err := val.Float()
+	if err != nil {
+		return parser.Failed(addr, modu.QualityDecodeFailed, err)
+	}
+	pv, err := parser.ApplyEnum(modu.ParseValue{Addr: addr, Value: applyScale(v, addr)})
+	if err != nil {
+		return parser.Failed(addr, modu.QualityDecodeFailed, err)
+	}
+	return parser.CheckRange(pv)
+}
+
+// ---------- 帧编码 ----------
+
+func bacnetFrame(function byte, npdu []byte, apdu []byte) []byte {
+	frame := []byte{bvlcType, function, 0, 0}
+	frame = append(frame, npdu...)
+	frame = append(frame, apdu...)
+	binary.BigEndian.PutUint16(frame[2:4], uint16(len(frame)))
+	return frame
+}
+
+// bacnetTag 编码标签，context 为 true 时为上下文标签
+func bacnetTag(num byte, context bool, content []byte) []byte {
+	var b byte
+	if num < 15 {
+		b = num << 4
+	} else {
+		b = 0xF0
+	}
+	if context {
+		b |= 0x08
+	}
+	var out []byte
+	switch l := len(content); {
+	case l < 5:
+		out = []byte{b | byte(l)}
+	case l < 254:
+		out = []byte{b | 5, byte(l)}
+	default:
+		out = []byte{b | 5, 254, byte(l >> 8), byte(l)}
+	}
+	if num >= 15 {
+		out = append(out[:1], append([]byte{num}, out[1:]...)...)
+	}
+	return append(out, content...)
+}
+
+func bacnetUnsigned(v uint32) []byte {
+	switch {
+	case v < 0x100:
+		return []byte{byte(v)}
+	case v < 0x10000:
+		return []byte{byte(v >> 8), byte(v)}
+	case v < 0x1000000:
+		return []byte{byte(v >> 16), byte(v >> 8), byte(v)}
+	}
+	return []byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+}
+
+func bacnetObjectID(id uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, id)
+	return b
+}
+
+func encodeReadProperty(invokeID byte, ref bacnetRef) []byte {
+	apdu := []byte{apduConfirmedReq, bacnetMaxAPDUAccepted, invokeID, serviceReadProperty}
+	apdu = append(apdu, bacnetTag(0, true, bacnetObjectID(ref.objectID()))...)
+	apdu = append(apdu, bacnetTag(1, true, bacnetUnsigned(ref.Property))...)
+	if ref.Index != bacnetNoIndex {
+		apdu = append(apdu, bacnetTag(2, true, bacnetUnsigned(ref.Index))...)
+	}
+	return apdu
+}
+
+func encodeReadPropertyMultiple(invokeID byte, refs []bacnetRef) []byte {
+	apdu := []byte{apduConfirmedReq, bacnetMaxAPDUAccepted, invokeID, serviceReadPropMultiple}
+	for i := 0; i < len(refs); {
+		obj := refs[i].objectID()
+		apdu = append(apdu, bacnetTag(0, true, bacnetObjectID(obj))...)
+		apdu = append(apdu, 0x1E) // opening tag 1
+		for ; i < len(refs) && refs[i].objectID() == obj; i++ {
+			apdu = append(apdu, bacnetTag(0, true, bacnetUnsigned(refs[i].Property))...)
+			if refs[i].Index != bacnetNoIndex {
+				apdu = append(apdu, bacnetTag(1, true, bacnetUnsigned(refs[i].Index))...)
+			}
+		}
+		apdu = append(apdu, 0x1F) // closing tag 1
+	}
+	return apdu
+}
+
+// ---------- 帧解码 ----------
+
+// bacnetAPDU 去掉 BVLC 与 NPDU，返回 APDU
+func bacnetAPDU(frame []byte) ([]byte, error) {
+	if len(frame) < 6 || frame[0] != bvlcType {
+		return nil, errors.New("bacnet: invalid bvlc")
+	}
+	l := int(binary.BigEndian.Uint16(frame[2:4]))
+	if l > len(frame) || l < 6 {
+		return nil, errors.New("bacnet: bvlc length mismatch")
+	}
+	frame = frame[:l]
+	pos := 4
+	if frame[1] == 0x04 { // Forwarded-NPDU 带原始地址
+		pos += 6
+	}
+	if len(frame) < pos+2 || frame[pos] != 0x01 {
+		return nil, errors.New("bacnet: invalid npdu")
+	}
+	control := frame[pos+1]
+	pos += 2
+	if control&0x80 != 0 {
+		return nil, errors.New("bacnet: network layer message")
+	}
+	hasDest := control&0x20 != 0
+	if hasDest {
+		if len(frame) < pos+3 {
+			return nil, errors.New("bacnet: invalid npdu")
+		}
+		pos += 3 + int(frame[pos+2])
+	}
+	if control&0x08 != 0 {
+		if len(frame) < pos+3 {
+			return nil, errors.New("bacnet: invalid npdu")
+		}
+		pos += 3 + int(frame[pos+2])
+	}
+	if hasDest {
+		pos++ // hop count
+	}
+	if pos > len(frame) {
+		return nil, errors.New("bacnet: invalid npdu")
+	}
+	return frame[pos:], nil
+}
+
+type bacnetTagInfo struct {
+	Num     byte
+	Context bool
+	Opening bool
+	Closing bool
+	Len     int // 应用标签 Boolean 时为值本身
+}
+
+func readBACnetTag(data []byte) (bacnetTagInfo, []byte, []byte, error) {
+	var t bacnetTagInfo
+	if len(data) < 1 {
+		return t, nil, nil, errors.New("bacnet: tag too short")
+	}
+	b := data[0]
+	pos := 1
+	t.Num = b >> 4
+	if t.Num == 15 {
+		if len(data) < 2 {
+			return t, nil, nil, errors.New("bacnet: tag too short")
+		}
+		t.Num = data[1]
+		pos++
+	}
+	t.Context = b&0x08 != 0
+	lvt := int(b & 0x07)
+	if t.Context && lvt == 6 {
+		t.Opening = true
+		return t, nil, data[pos:], nil
+	}
+	if t.Context && lvt == 7 {
+		t.Closing = true
+		return t, nil, data[pos:], nil
+	}
+	if lvt == 5 {
+		if len(data) < pos+1 {
+			return t, nil, nil, errors.New("bacnet: tag too short")
+		}
+		lvt = int(data[pos])
+		pos++
+		switch lvt {
+		case 254:
+			if len(data) < pos+2 {
+				return t, nil, nil, errors.New("bacnet: tag too short")
+			}
+			lvt = int(binary.BigEndian.Uint16(data[pos:]))
+			pos += 2
+		case 255:
+			if len(data) < pos+4 {
+				return t, nil, nil, errors.New("bacnet: tag too short")
+			}
+			lvt = int(binary.BigEndian.Uint32(data[pos:]))
+			pos += 4
+		}
+	}
+	t.Len = lvt
+	if !t.Context && t.Num == 1 { // Boolean 的值在长度字段中
+		return t, nil, data[pos:], nil
+	}
+	if lvt < 0 || len(data) < pos+lvt {
+		return t, nil, nil, errors.New("bacnet: tag content too short")
+	}
+	return t, data[pos : pos+lvt], data[pos+lvt:], nil
+}
+
+// bacnetValue 应用标签编码的属性值
+type bacnetValue struct {
+	Tag     byte
+	Content []byte
+	Bool    bool
+	err     error
+}
+
+// Float 将数值类属性值转换为 float64
+func (v bacnetValue) Float() (float64, error) {
+	switch v.Tag {
+	case 1:
+		if v.Bool {
+			return 1, nil
+		}
+		return 0, nil
+	case 2, 9:
+		return float64(berDecodeUnsigned(v.Content)), nil
+	case 3:
+		return float64(berDecodeInteger(v.Content)), nil
+	case 4:
+		if len(v.Content) != 4 {
+			return 0, errors.New("bacnet: invalid real")
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(v.Content))), nil
+	case 5:
+		if len(v.Content) != 8 {
+			return 0, errors.New("bacnet: invalid double")
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(v.Content)), nil
+	}
+	return 0, fmt.Errorf("bacnet: application tag %d is not numeric", v.Tag)
+}
+
+// readBACnetValues 读取直到指定编号的结束标签，返回其中第一个应用值
+func readBACnetValues(data []byte, closing byte) (bacnetValue, []byte, error) {
+	var val bacnetValue
+	first := true
+	depth := 0
+	for {
+		t, content, rest, err := readBACnetTag(data)
+		if err != nil {
+			return val, nil, err
+		}
+		data = rest
+		switch {
+		case t.Opening:
+			depth++
+		case t.Closing && depth == 0:
+			if t.Num != closing {
+				return val, nil, errors.New("bacnet: unbalanced tags")
+			}
+			return val, data, nil
+		case t.Closing:
+			depth--
+		case first && !t.Context:
+			val.Tag = t.Num
+			val.Content = content
+			val.Bool = t.Num == 1 && t.Len != 0
+			first = false
+		}
+	}
+}
+
+// decodeBACnetAck 解析应答，返回属性引用到值的映射
+func decodeBACnetAck(apdu []byte) (map[string]bacnetValue, error) {
+	if len(apdu) < 2 {
+		return nil, errors.New("bacnet: apdu too short")
+	}
+	switch apdu[0] & 0xF0 {
+	case apduComplexAck:
+	case apduError:
+		if len(apdu) >= 3 {
+			return nil, fmt.Errorf("bacnet error: %s", decodeBACnetError(apdu[3:]))
+		}
+		return nil, errors.New("bacnet error")
+	case apduReject:
+		return nil, fmt.Errorf("bacnet reject: reason %d", apdu[len(apdu)-1])
+	case apduAbort:
+		return nil, fmt.Errorf("bacnet abort: reason %d", apdu[len(apdu)-1])
+	default:
+		return nil, fmt.Errorf("bacnet: unexpected pdu 0x%02X", apdu[0])
+	}
+	if apdu[0]&0x08 != 0 {
+		return nil, errors.New("bacnet: segmented response not supported")
+	}
+	if len(apdu) < 3 {
+		return nil, errors.New("bacnet: apdu too short")
+	}
+	values := make(map[string]bacnetValue)
+	service := apdu[2]
+	data := apdu[3:]
+	switch service {
+	case serviceReadProperty:
+		var ref bacnetRef
+		ref.Index = bacnetNoIndex
+		for len(data) > 0 {
+			t, content, rest, err := readBACnetTag(data)
+			if err != nil {
+				return nil, err
+			}
+			data = rest
+			switch {
+			case t.Context && t.Num == 0 && !t.Opening:
+				id := uint32(berDecodeUnsigned(content))
+				ref.ObjType, ref.Instance = id>>22, id&0x3FFFFF
+			case t.Context && t.Num == 1:
+				ref.Property = uint32(berDecodeUnsigned(content))
+			case t.Context && t.Num == 2:
+				ref.Index = uint32(berDecodeUnsigned(content))
+			case t.Opening && t.Num == 3:
+				val, rest, err := readBACnetValues(data, 3)
+				if err != nil {
+					return nil, err
+				}
+				values[ref.key()] = val
+				data = rest
+			}
+		}
+	case serviceReadPropMultiple:
+		var ref bacnetRef
+		for len(data) > 0 {
+			t, content, rest, err := readBACnetTag(data)
+			if err != nil {
+				return nil, err
+			}
+			data = rest
+			switch {
+			case t.Context && t.Num == 0 && !t.Opening && !t.Closing:
+				id := uint32(berDecodeUnsigned(content))
+				ref.ObjType, ref.Instance = id>>22, id&0x3FFFFF
+			case t.Context && t.Num == 2 && !t.Opening && !t.Closing:
+				ref.Property = uint32(berDecodeUnsigned(content))
+				ref.Index = bacnetNoIndex
+			case t.Context && t.Num == 3 && !t.Opening && !t.Closing:
+				ref.Index = uint32(berDecodeUnsigned(content))
+			case t.Opening && t.Num == 4:
+				val, rest, err := readBACnetValues(data, 4)
+				if err != nil {
+					return nil, err
+				}
+				values[ref.key()] = val
+				data = rest
+			case t.Opening && t.Num == 5:
+				errData := data
+				_, rest, err := readBACnetValues(data, 5)
+				if err != nil {
+					return nil, err
+				}
+				values[ref.key()] = bacnetValue{err: fmt.Errorf("bacnet error: %s", decodeBACnetError(errData))}
+				data = rest
+			}
+		}
+	default:
+		return nil, fmt.Errorf("bacnet: unexpected service %d", service)
+	}
+	return values, nil
+}
+
+// decodeBACnetError 解析 error-class 与 error-code
+func decodeBACnetError(data []byte) string {
+	var codes []string
+	for len(data) > 0 && len(codes) < 2 {
+		t, content, rest, err := readBACnetTag(data)
+		if err != nil || t.Closing {
+			break
+		}
+		data = rest
+		if !t.Context && t.Num == 9 {
+			codes = append(codes, strconv.FormatUint(berDecodeUnsigned(content), 10))
+		}
+	}
+	if len(codes) == 2 {
+		return fmt.Sprintf("class %s code %s", codes[0], codes[1])
+	}
+	return "unknown"
+}
+
+// ---------- 设备发现 ----------
+
+// BACnetDevice Who-Is 发现到的设备
+type BACnetDevice struct {
+	Instance     uint32 // 设备实例号
+	Address      string // IP:端口
+	MaxAPDU      int
+	Segmentation int
+	VendorID     int
+}
+
+// BACnetWhoIs 广播 Who-Is 并收集超时时间内返回的 I-Am。
+// broadcast 为广播地址（如 "192.168.1.255:47808"），low/high 小于 0 时不限定实例范围。
+func BACnetWhoIs(broadcast string, low, high int, timeout time.Duration) ([]BACnetDevice, error) {
+	if !strings.Contains(broadcast, ":") {
+		broadcast = fmt.Sprintf("%s:%d", broadcast, bacnetDefaultPort)
+	}
+	dst, err := net.ResolveUDPAddr("udp4", broadcast)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	apdu := []byte{apduUnconfirmedReq, serviceUnconfirmedWhoIs}
+	if low >= 0 && high >= low {
+		apdu = append(apdu, bacnetTag(0, true, bacnetUnsigned(uint32(low)))...)
+		apdu = append(apdu, bacnetTag(1, true, bacnetUnsigned(uint32(high)))...)
+	}
+	// 全局广播：DNET=0xFFFF，DLEN=0，跳数 255
+	frame := bacnetFrame(bvlcBroadcastNPDU, []byte{0x01, 0x20, 0xFF, 0xFF, 0x00, 0xFF}, apdu)
+	if _, err = conn.WriteToUDP(frame, dst); err != nil {
+		return nil, err
+	}
+
+	var devices []BACnetDevice
+	seen := make(map[uint32]bool)
+	if err = conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 1500)
+	for {
+		n, src, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				break
+			}
+			return devices, err
+		}
+		d, err := decodeIAm(buf[:n])
+		if err != nil || seen[d.Instance] {
+			continue
+		}
+		seen[d.Instance] = true
+		d.Address = src.String()
+		devices = append(devices, d)
+	}
+	return devices, nil
+}
+
+func decodeIAm(frame []byte) (BACnetDevice, error) {
+	var d BACnetDevice
+	apdu, err := bacnetAPDU(frame)
+	if err != nil {
+		return d, err
+	}
+	if len(apdu) < 2 || apdu[0] != apduUnconfirmedReq || apdu[1] != serviceUnconfirmedIAm {
+		return d, errors.New("bacnet: not i-am")
+	}
+	data := apdu[2:]
+	var fields []uint64
+	for len(data) > 0 && len(fields) < 4 {
+		t, content, rest, err := readBACnetTag(data)
+		if err != nil {
+			return d, err
+		}
+		data = rest
+		fields = append(fields, berDecodeUnsigned(content))
+		if len(fields) == 1 && (t.Context || t.Num != 12) {
+			return d, errors.New("bacnet: invalid i-am")
+		}
+	}
+	if len(fields) < 4 {
+		return d, errors.New("bacnet: i-am too short")
+	}
+	d.Instance = uint32(fields[0]) & 0x3FFFFF
+	d.MaxAPDU = int(fields[1])
+	d.Segmentation = int(fields[2])
+	d.VendorID = int(fields[3])
+	return d, nil
+}
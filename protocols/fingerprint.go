@@ -0,0 +1,282 @@
+package protocols
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/zoneBen/ProtoHub/checksum"
+)
+
+// Candidate 协议识别的候选结果
+type Candidate struct {
+	Protocol   string
+	Confidence float64  // 0 到 1
+	Reasons    []string // 命中的特征
+}
+
+func (c Candidate) String() string {
+	return fmt.Sprintf("%s %.0f%%: %s", c.Protocol, c.Confidence*100, strings.Join(c.Reasons, "，"))
+}
+
+// candidate 累计特征得分
+type candidate struct {
+	Candidate
+	score float64
+}
+
+func (c *candidate) hit(score float64, reason string, args ...interface{}) {
+	c.score += score
+	c.Reasons = append(c.Reasons, fmt.Sprintf(reason, args...))
+}
+
+type fingerprinter func(data []byte) *candidate
+
+// 各协议的特征，每项满分为 1
+var fingerprinters = []fingerprinter{
+	fingerprintYDT,
+	fingerprintDLT645,
+	fingerprintModbusRTU,
+	fingerprintModbusASCII,
+	fingerprintModbusTCP,
+	fingerprintMegatec,
+	fingerprintText,
+}
+
+// Fingerprint 根据设备的一段原始响应推测协议，按置信度从高到低返回候选，未命中任何特征时返回空。
+// 特征包括帧起止符（电总 0x7E…0x0D、DL/T 645 0x68…0x16 等）、长度字段、校验值与 ASCII 内容，
+// 校验通过是最强的特征；结果用于辅助接入未知设备，不代表确定的判断。
+func Fingerprint(data []byte) []Candidate {
+	var out []Candidate
+	if len(data) == 0 {
+		return out
+	}
+	for _, fp := range fingerprinters {
+		c := fp(data)
+		if c == nil || c.score <= 0 {
+			continue
+		}
+		c.Confidence = c.score
+		if c.Confidence > 1 {
+			c.Confidence = 1
+		}
+		out = append(out, c.Candidate)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Confidence > out[j].Confidence })
+	return out
+}
+
+// isHexText 是否全部为十六进制字符
+func isHexText(b []byte) bool {
+	if len(b) == 0 {
+		return false
+	}
+	for _, c := range b {
+		if !(c >= '0' && c <= '9' || c >= 'A' && c <= 'F' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// printableRatio 可打印 ASCII（含空白）所占比例
+func printableRatio(b []byte) float64 {
+	if len(b) == 0 {
+		return 0
+	}
+	n := 0
+	for _, c := range b {
+		if c >= 0x20 && c < 0x7F || c == '\r' || c == '\n' || c == '\t' {
+			n++
+		}
+	}
+	return float64(n) / float64(len(b))
+}
+
+// fingerprintYDT 电总：~ VER ADR CID1 RTN LENGTH INFO CHKSUM \r，除 SOI、EOI 外为十六进制文本
+func fingerprintYDT(data []byte) *candidate {
+	c := &candidate{Candidate: Candidate{Protocol: "ydt1363"}}
+	if data[0] != 0x7E || data[len(data)-1] != 0x0D {
+		return nil
+	}
+	c.hit(0.3, "以0x7E开始、0x0D结束")
+	body := data[1 : len(data)-1]
+	if !isHexText(body) || len(body) < 16 || len(body)%2 != 0 {
+		return c
+	}
+	c.hit(0.15, "帧体为十六进制文本")
+	head, _ := hex.DecodeString(string(body[:12]))
+	lenID := int(head[4]&0x0F)<<8 | int(head[5])
+	sum := lenID>>8&0x0F + lenID>>4&0x0F + lenID&0x0F
+	if (^sum+1)&0x0F == int(head[4]>>4) && len(body) == 12+lenID+4 {
+		c.hit(0.2, "LENGTH校验与INFO长度%d一致", lenID)
+	}
+	if _, err := ydtChecksum.Verify(data, 1); err == nil {
+		c.hit(0.35, "CHKSUM校验通过")
+	}
+	c.hit(0, "VER=%02X ADR=%02X CID1=%02X RTN=%02X", head[0], head[1], head[2], head[3])
+	return c
+}
+
+var sum8 = mustChecksum(checksum.SUM8)
+
+// fingerprintDLT645 DL/T 645：[FE…] 68 A0-A5 68 C L DATA CS 16
+func fingerprintDLT645(data []byte) *candidate {
+	c := &candidate{Candidate: Candidate{Protocol: "dlt645"}}
+	frame := bytes.TrimLeft(data, "\xFE")
+	if len(frame) < 12 || frame[0] != 0x68 || frame[7] != 0x68 {
+		return nil
+	}
+	c.hit(0.3, "第1、8字节为0x68")
+	if len(frame) < len(data) {
+		c.hit(0.05, "带0xFE前导字节")
+	}
+	if frame[len(frame)-1] == 0x16 {
+		c.hit(0.15, "以0x16结束")
+	}
+	l := int(frame[9])
+	if len(frame) == 12+l {
+		c.hit(0.2, "长度L=%d与帧长一致", l)
+		if byte(sum8.Sum(frame[:10+l])) == frame[10+l] {
+			c.hit(0.3, "CS校验通过")
+		}
+	}
+	c.hit(0, "地址%X 控制码%02X", reverseBytes(frame[1:7]), frame[8])
+	return c
+}
+
+func reverseBytes(b []byte) []byte {
+	out := make([]byte, len(b))
+	for i := range b {
+		out[i] = b[len(b)-1-i]
+	}
+	return out
+}
+
+// modbusKnownFunction 常见功能码（含异常响应）
+func modbusKnownFunction(fc byte) bool {
+	switch fc &^ 0x80 {
+	case ModbusReadCoils, ModbusReadDiscreteInputs, ModbusReadHoldingRegisters, ModbusReadInputRegisters,
+		ModbusWriteSingleCoil, ModbusWriteSingleRegister, ModbusWriteMultipleCoils, ModbusWriteMultipleRegisters:
+		return true
+	}
+	return false
+}
+
+// modbusPDUConsistent 响应 PDU 的长度与功能码、字节数一致
+func modbusPDUConsistent(pdu []byte) bool {
+	return modbusKnownFunction(pdu[0]) && modbusPDULen(pdu) == len(pdu)
+}
+
+// fingerprintModbusRTU Modbus RTU：地址 功能码 数据 CRC16（低字节在前）
+func fingerprintModbusRTU(data []byte) *candidate {
+	c := &candidate{Candidate: Candidate{Protocol: "modbus-rtu"}}
+	if len(data) < 5 {
+		return nil
+	}
+	if _, err := modbusCRC.Verify(data, 0); err == nil {
+		c.hit(0.6, "CRC16/MODBUS校验通过")
+	}
+	pdu := data[1 : len(data)-2]
+	if data[0] >= 1 && data[0] <= 247 && modbusKnownFunction(pdu[0]) {
+		c.hit(0.15, "从站地址%d 功能码%02X", data[0], pdu[0])
+		if modbusPDUConsistent(pdu) {
+			c.hit(0.2, "字节数与帧长一致")
+		}
+		if pdu[0]&0x80 != 0 {
+			c.hit(0, "异常响应%02X", pdu[1])
+		}
+	}
+	if c.score < 0.6 {
+		// 没有校验通过时仅凭地址与功能码不足以判断
+		c.score /= 2
+	}
+	return c
+}
+
+// fingerprintModbusASCII Modbus ASCII：':' 十六进制文本 LRC CRLF
+func fingerprintModbusASCII(data []byte) *candidate {
+	c := &candidate{Candidate: Candidate{Protocol: "modbus-ascii"}}
+	if data[0] != ':' || !bytes.HasSuffix(data, []byte("\r\n")) {
+		return nil
+	}
+	c.hit(0.3, "以':'开始、CRLF结束")
+	text := data[1 : len(data)-2]
+	if !isHexText(text) || len(text)%2 != 0 || len(text) < 6 {
+		return c
+	}
+	c.hit(0.15, "帧体为十六进制文本")
+	body, _ := hex.DecodeString(string(text))
+	if _, err := modbusLRC.Verify(body, 0); err == nil {
+		c.hit(0.4, "LRC校验通过")
+	}
+	if modbusPDUConsistent(body[1 : len(body)-1]) {
+		c.hit(0.15, "从站地址%d 功能码%02X", body[0], body[1])
+	}
+	return c
+}
+
+// fingerprintModbusTCP Modbus TCP：MBAP 头（事务号、协议号 0、长度、单元号）+ PDU
+func fingerprintModbusTCP(data []byte) *candidate {
+	c := &candidate{Candidate: Candidate{Protocol: "modbus-tcp"}}
+	if len(data) < 9 || binary.BigEndian.Uint16(data[2:]) != 0 {
+		return nil
+	}
+	if int(binary.BigEndian.Uint16(data[4:])) != len(data)-6 {
+		return nil
+	}
+	c.hit(0.6, "MBAP协议号为0且长度一致")
+	if modbusPDUConsistent(data[7:]) {
+		c.hit(0.3, "单元号%d 功能码%02X", data[6], data[7])
+	}
+	return c
+}
+
+// fingerprintMegatec Megatec/Voltronic：'(' 或 '#' 开始、'\r' 结束的文本，字段以空格分隔
+func fingerprintMegatec(data []byte) *candidate {
+	c := &candidate{Candidate: Candidate{Protocol: "megatec"}}
+	if data[0] != '(' && data[0] != '#' || data[len(data)-1] != '\r' {
+		return nil
+	}
+	c.hit(0.3, "以'%c'开始、回车结束", data[0])
+	body := data[1 : len(data)-1]
+	if len(body) >= 2 {
+		if string(voltronicCRC(data[:len(data)-3])) == string(data[len(data)-3:len(data)-1]) {
+			c.hit(0.5, "Voltronic CRC校验通过")
+			body = body[:len(body)-2]
+		}
+	}
+	if printableRatio(body) == 1 {
+		fields := strings.Fields(string(body))
+		numeric := 0
+		for _, f := range fields {
+			if strings.Trim(f, "0123456789.") == "" {
+				numeric++
+			}
+		}
+		if len(fields) >= 3 && numeric*2 >= len(fields) {
+			c.hit(0.4, "%d个空格分隔的数值字段", len(fields))
+		}
+	}
+	return c
+}
+
+// fingerprintText 通用文本协议，置信度较低，作为其他协议都不匹配时的参考
+func fingerprintText(data []byte) *candidate {
+	c := &candidate{Candidate: Candidate{Protocol: "text"}}
+	ratio := printableRatio(data)
+	if ratio < 0.9 {
+		return nil
+	}
+	c.hit(0.3*ratio, "%.0f%%为可打印ASCII", ratio*100)
+	if data[len(data)-1] == '\n' || data[len(data)-1] == '\r' {
+		c.hit(0.1, "以行结束符结束")
+	}
+	if bytes.ContainsAny(data, "0123456789") {
+		c.hit(0.05, "包含数值")
+	}
+	return c
+}
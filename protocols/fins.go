@@ -0,0 +1,210 @@
+package protocols
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/zoneBen/ProtoHub/core"
+	"github.com/zoneBen/ProtoHub/modu"
+)
+
+// FINSProtocol 欧姆龙 FINS/TCP 读取协议。
+// EAddr.Command 为存储区加字地址，如 "D100"、"CIO20"、"H5"；
+// EDev.Addr 为 PLC 节点号（十进制），为空时使用握手返回的节点号。
+// 缺省数据类型 UINT16，缺省字节序 AB（大端）。
+type FINSProtocol struct {
+	MaxWords int           // 单次读取的最大字数，默认 500
+	Timeout  time.Duration // 单次请求超时，默认 3 秒
+}
+
+var finsAreas = map[string]plcArea{
+	"CIO": {Code: 0xB0},
+	"W":   {Code: 0xB1},
+	"WR":  {Code: 0xB1},
+	"H":   {Code: 0xB2},
+	"HR":  {Code: 0xB2},
+	"A":   {Code: 0xB3},
+	"AR":  {Code: 0xB3},
+	"D":   {Code: 0x82},
+	"DM":  {Code: 0x82},
+	"T":   {Code: 0x89},
+	"TIM": {Code: 0x89},
+}
+
+const (
+	finsHeaderLen   = 16 // FINS/TCP 头
+	finsFrameHeader = 10 // FINS 命令头（ICF 至 SID）
+	finsDataOffset  = finsHeaderLen + finsFrameHeader + 4
+)
+
+var finsSID uint32
+
+func (p *FINSProtocol) maxWords() int {
+	if p.MaxWords > 0 {
+		return p.MaxWords
+	}
+	return 500
+}
+
+func (p *FINSProtocol) timeout() time.Duration {
+	if p.Timeout > 0 {
+		return p.Timeout
+	}
+	return 3 * time.Second
+}
+
+// GenerateCommands 生成命令键与内容的映射，节点号在 Send 握手后填入
+func (p *FINSProtocol) GenerateCommands(dev *modu.EParser) (map[string][]byte, error) {
+	commands := make(map[string][]byte)
+	for _, addr := range dev.Addrs {
+		if _, _, err := parsePLCPoint(addr, finsAreas); err != nil {
+			log.Printf("测点%s配置错误: %v", addr.MetricName, err)
+			return nil, err
+		}
+	}
+	for _, block := range plcBlocks(dev, finsAreas, p.maxWords()) {
+		if _, ok := commands[block.key()]; ok {
+			continue
+		}
+		fins := []byte{0x80, 0x00, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+			byte(atomic.AddUint32(&finsSID, 1)), 0x01, 0x01, finsAreas[block.Area].Code,
+			byte(block.Start >> 8), byte(block.Start), 0x00, byte(block.Words >> 8), byte(block.Words)}
+		commands[block.key()] = finsTCPFrame(2, fins)
+	}
+	return commands, nil
+}
+
+func finsTCPFrame(command uint32, payload []byte) []byte {
+	frame := make([]byte, finsHeaderLen, finsHeaderLen+len(payload))
+	copy(frame, "FINS")
+	binary.BigEndian.PutUint32(frame[4:], uint32(8+len(payload)))
+	binary.BigEndian.PutUint32(frame[8:], command)
+	return append(frame, payload...)
+}
+
+func (p *FINSProtocol) GenerateKey(dev *modu.EParser, addr modu.EAddr) string {
+	return plcKey(plcBlocks(dev, finsAreas, p.maxWords()), addr, finsAreas)
+}
+
+// GetCommandAddrs 获取命令对应的测点
+func (p *FINSProtocol) GetCommandAddrs(dev *modu.EParser, commandKey string) []modu.EAddr {
+	return plcCommandAddrs(dev, finsAreas, p.maxWords(), commandKey)
+}
+
+// Send 完成节点握手后发送读取命令
+func (p *FINSProtocol) Send(transport core.Transport, sendBuf []byte, dev *modu.EParser) ([]byte, error) {
+	if len(sendBuf) < finsHeaderLen+finsFrameHeader {
+		return nil, errors.New("invalid fins request")
+	}
+	err := transport.Connect()
+	if err != nil {
+		log.Println("FINSProtocol Send connect err:", err)
+		return nil, err
+	}
+	defer transport.Close()
+
+	// 节点地址握手，客户端节点号为 0 时由 PLC 自动分配
+	err = transport.Write(finsTCPFrame(0, []byte{0, 0, 0, 0}))
+	if err != nil {
+		return nil, fmt.Errorf("write failed: %w", err)
+	}
+	resp, err := p.readFrame(transport, time.Now().Add(p.timeout()))
+	if err != nil {
+		return nil, err
+	}
+	if len(resp) < 24 || binary.BigEndian.Uint32(resp[8:]) != 1 {
+		return nil, errors.New("fins handshake failed")
+	}
+	if code := binary.BigEndian.Uint32(resp[12:]); code != 0 {
+		return nil, fmt.Errorf("fins handshake error 0x%08X", code)
+	}
+	clientNode := resp[19]
+	serverNode := resp[23]
+	if dev.Dev.Addr != "" {
+		n, err := strconv.ParseUint(dev.Dev.Addr, 10, 8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid fins node %q", dev.Dev.Addr)
+		}
+		serverNode = byte(n)
+	}
+
+	req := append([]byte(nil), sendBuf...)
+	req[finsHeaderLen+4] = serverNode // DA1
+	req[finsHeaderLen+7] = clientNode // SA1
+	err = transport.Write(req)
+	if err != nil {
+		return nil, fmt.Errorf("write failed: %w", err)
+	}
+	sid := req[finsHeaderLen+9]
+	// SID 不符的帧丢弃，但总等待时间不超过一次超时
+	endTime := time.Now().Add(p.timeout())
+	for {
+		resp, err = p.readFrame(transport, endTime)
+		if err != nil {
+			return nil, err
+		}
+		if len(resp) >= finsDataOffset && resp[finsHeaderLen+9] == sid {
+			return resp, nil
+		}
+	}
+}
+
+// readFrame 按 FINS/TCP 头中的长度读取完整帧，endTime 前未读到时返回超时
+func (p *FINSProtocol) readFrame(transport core.Transport, endTime time.Time) ([]byte, error) {
+	var received []byte
+	for time.Now().Before(endTime) {
+		ctx, cancel := context.WithDeadline(context.Background(), endTime)
+		data, err := transport.ReadWithContext(ctx)
+		cancel()
+		if err != nil {
+			if errors.Is(err, context.DeadlineExceeded) {
+				break
+			}
+			return nil, fmt.Errorf("read error: %w", err)
+		}
+		received = append(received, data...)
+		if len(received) >= 8 {
+			if string(received[:4]) != "FINS" {
+				return nil, errors.New("invalid fins header")
+			}
+			total := 8 + int(binary.BigEndian.Uint32(received[4:]))
+			if len(received) >= total {
+				return received[:total], nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("fins timeout after %v", p.timeout())
+}
+
+// ParseResponse 解析响应数据
+func (p *FINSProtocol) ParseResponse(data []byte, dev *modu.EParser, addrs []modu.EAddr) (map[string]modu.ParseValue, error) {
+	if len(data) < finsDataOffset || string(data[:4]) != "FINS" {
+		return plcFailAll(addrs, errors.New("invalid fins response"))
+	}
+	if code := binary.BigEndian.Uint32(data[12:]); code != 0 {
+		return plcFailAll(addrs, fmt.Errorf("fins tcp error 0x%08X", code))
+	}
+	// 主、副响应码中除去标志位后非 0 为错误，0x8000 为网络中继错误，0x0080、0x0040 为 CPU 异常标志，仅作为警告
+	end := binary.BigEndian.Uint16(data[finsDataOffset-2:])
+	if end&0x7F3F != 0 {
+		return plcFailAll(addrs, fmt.Errorf("fins end code 0x%04X", end))
+	}
+	return plcParseWords(data[finsDataOffset:], dev, addrs, finsAreas, finsByteOrder)
+}
+
+// finsByteOrder 字内高字节在前，DINT、REAL 等多字数据低位字在前
+func finsByteOrder(size int) string {
+	switch size {
+	case 4:
+		return "CDAB"
+	case 8:
+		return "GHEFCDAB"
+	}
+	return "AB"
+}
@@ -0,0 +1,461 @@
+package protocols
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/zoneBen/ProtoHub/checksum"
+	"github.com/zoneBen/ProtoHub/core"
+	"github.com/zoneBen/ProtoHub/modu"
+	"github.com/zoneBen/ProtoHub/parser"
+)
+
+// FrameProtocol 按 EDev.Frame 模板收发的自定义二进制协议，
+// 适用于帧头、地址、命令、长度、负载、校验、帧尾组成的私有协议（电池监测仪、油机控制器等）。
+// 响应负载按 HexParser 以 BIN 编码解析，EDev.Encoding 或 EAddr.Encoding 可覆盖。
+type FrameProtocol struct{}
+
+// 模板元素
+const (
+	frameLiteral = iota
+	frameAny
+	frameAddr
+	frameCmd
+	frameLen
+	frameData
+	frameCRC
+)
+
+var frameFields = map[string]int{
+	"{addr}": frameAddr,
+	"{cmd}":  frameCmd,
+	"{len}":  frameLen,
+	"{data}": frameData,
+	"{crc}":  frameCRC,
+}
+
+type frameToken struct {
+	kind  int
+	bytes []byte // 字节常量
+}
+
+// ErrIncompleteFrame 响应尚未接收完整，帧模板与总线扫描的探测使用
+var ErrIncompleteFrame = errors.New("帧不完整")
+
+// frameTemplate 解析后的帧模板
+type frameTemplate struct {
+	tokens       []frameToken
+	lengthSize   int
+	littleEndian bool
+	lengthAdjust int
+	spec         *checksum.Spec
+}
+
+// parseFrameTemplate 解析模板，相邻的十六进制字节可以连写，如 "55AA"
+func parseFrameTemplate(s string, dev modu.EDev) (*frameTemplate, error) {
+	t := &frameTemplate{lengthSize: 1, lengthAdjust: dev.Frame.LengthAdjust}
+	if dev.Frame.LengthSize > 0 {
+		t.lengthSize = dev.Frame.LengthSize
+	}
+	if t.lengthSize > 4 {
+		return nil, fmt.Errorf("长度字段%d字节过长", t.lengthSize)
+	}
+	switch strings.ToUpper(dev.Frame.LengthOrder) {
+	case "", "BE":
+	case "LE":
+		t.littleEndian = true
+	default:
+		return nil, fmt.Errorf("不支持的长度字节序: %s", dev.Frame.LengthOrder)
+	}
+	var err error
+	if t.spec, err = checksum.FromDev(dev); err != nil {
+		return nil, err
+	}
+	seen := make(map[int]bool)
+	for _, item := range strings.Fields(s) {
+		if kind, ok := frameFields[strings.ToLower(item)]; ok {
+			if seen[kind] {
+				return nil, fmt.Errorf("帧模板中%s重复", item)
+			}
+			seen[kind] = true
+			t.tokens = append(t.tokens, frameToken{kind: kind})
+			continue
+		}
+		if item == "??" {
+			t.tokens = append(t.tokens, frameToken{kind: frameAny})
+			continue
+		}
+		b, err := getBytes(item)
+		if err != nil {
+			return nil, fmt.Errorf("帧模板元素%q无效", item)
+		}
+		t.tokens = append(t.tokens, frameToken{kind: frameLiteral, bytes: b})
+	}
+	if len(t.tokens) == 0 {
+		return nil, errors.New("帧模板为空")
+	}
+	if seen[frameCRC] && t.spec == nil {
+		return nil, errors.New("帧模板包含{crc}但设备未配置Checksum")
+	}
+	return t, nil
+}
+
+// frameTemplates 请求与响应模板
+func frameTemplates(dev *modu.EParser) (req, resp *frameTemplate, err error) {
+	if dev.Dev.Frame.Request == "" {
+		return nil, nil, errors.New("设备未配置帧模板")
+	}
+	if req, err = parseFrameTemplate(dev.Dev.Frame.Request, dev.Dev); err != nil {
+		return nil, nil, fmt.Errorf("请求模板: %w", err)
+	}
+	if dev.Dev.Frame.Response == "" {
+		return req, req, nil
+	}
+	if resp, err = parseFrameTemplate(dev.Dev.Frame.Response, dev.Dev); err != nil {
+		return nil, nil, fmt.Errorf("响应模板: %w", err)
+	}
+	return req, resp, nil
+}
+
+// hexField 十六进制配置转换为字节，允许空格分隔
+func hexField(s string) ([]byte, error) {
+	return getBytes(strings.ReplaceAll(s, " ", ""))
+}
+
+// encodeLength 按长度字段的宽度与字节序编码
+func (t *frameTemplate) encodeLength(n int) ([]byte, error) {
+	if n < 0 || t.lengthSize < 4 && n >= 1<<(8*t.lengthSize) {
+		return nil, fmt.Errorf("长度%d超出长度字段范围", n)
+	}
+	out := make([]byte, t.lengthSize)
+	for i := t.lengthSize - 1; i >= 0; i-- {
+		out[i] = byte(n)
+		n >>= 8
+	}
+	if t.littleEndian {
+		for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+			out[i], out[j] = out[j], out[i]
+		}
+	}
+	return out, nil
+}
+
+func (t *frameTemplate) decodeLength(b []byte) int {
+	n := 0
+	for i := range b {
+		if t.littleEndian {
+			n = n<<8 | int(b[len(b)-1-i])
+		} else {
+			n = n<<8 | int(b[i])
+		}
+	}
+	return n
+}
+
+// build 构建请求帧
+func (t *frameTemplate) build(dev *modu.EParser, addr modu.EAddr) ([]byte, error) {
+	devAddr, err := hexField(dev.Dev.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("设备地址: %w", err)
+	}
+	cmd, err := hexField(addr.Command)
+	if err != nil {
+		return nil, fmt.Errorf("命令: %w", err)
+	}
+	data, err := hexField(addr.CommandExtra)
+	if err != nil {
+		return nil, fmt.Errorf("命令内容: %w", err)
+	}
+	var frame []byte
+	for _, tok := range t.tokens {
+		switch tok.kind {
+		case frameLiteral:
+			frame = append(frame, tok.bytes...)
+		case frameAny:
+			return nil, errors.New("请求模板不能包含??")
+		case frameAddr:
+			frame = append(frame, devAddr...)
+		case frameCmd:
+			frame = append(frame, cmd...)
+		case frameLen:
+			b, err := t.encodeLength(len(data) + t.lengthAdjust)
+			if err != nil {
+				return nil, err
+			}
+			frame = append(frame, b...)
+		case frameData:
+			frame = append(frame, data...)
+		case frameCRC:
+			if frame, err = t.spec.Append(frame); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return frame, nil
+}
+
+// fixedSize 元素的固定字节数，{data} 返回 -1
+func (t *frameTemplate) fixedSize(tok frameToken, devAddr, cmd []byte) int {
+	switch tok.kind {
+	case frameLiteral:
+		return len(tok.bytes)
+	case frameAny:
+		return 1
+	case frameAddr:
+		return len(devAddr)
+	case frameCmd:
+		return len(cmd)
+	case frameLen:
+		return t.lengthSize
+	case frameCRC:
+		return t.spec.Len()
+	}
+	return -1
+}
+
+// sync 丢弃帧头之前的杂散字节
+func (t *frameTemplate) sync(buf []byte) []byte {
+	if t.tokens[0].kind != frameLiteral {
+		return buf
+	}
+	head := t.tokens[0].bytes
+	if i := bytes.Index(buf, head); i >= 0 {
+		return buf[i:]
+	}
+	// 保留可能是帧头前半部分的尾部字节
+	for n := len(head) - 1; n > 0; n-- {
+		if len(buf) >= n && bytes.HasPrefix(head, buf[len(buf)-n:]) {
+			return buf[len(buf)-n:]
+		}
+	}
+	return nil
+}
+
+// parse 按响应模板校验帧并返回 {data} 负载，帧长度不足时返回 ErrIncompleteFrame。
+// 没有长度字段时，负载之后的帧尾或校验不符可能只是数据尚未收完，同样作为 ErrIncompleteFrame 返回
+func (t *frameTemplate) parse(buf []byte, dev *modu.EParser, addr modu.EAddr) ([]byte, error) {
+	payload, inferred, err := t.parseFrame(buf, dev, addr)
+	if err != nil && inferred && !errors.Is(err, ErrIncompleteFrame) {
+		return nil, fmt.Errorf("%w: %v", ErrIncompleteFrame, err)
+	}
+	return payload, err
+}
+
+// parseFrame 校验帧，inferred 表示错误发生在按帧长推算的负载之后
+func (t *frameTemplate) parseFrame(buf []byte, dev *modu.EParser, addr modu.EAddr) (payload []byte, inferred bool, err error) {
+	devAddr, err := hexField(dev.Dev.Addr)
+	if err != nil {
+		return nil, false, fmt.Errorf("设备地址: %w", err)
+	}
+	cmd, err := hexField(addr.Command)
+	if err != nil {
+		return nil, false, fmt.Errorf("命令: %w", err)
+	}
+	dataLen := -1
+	pos := 0
+	for i, tok := range t.tokens {
+		size := t.fixedSize(tok, devAddr, cmd)
+		if tok.kind == frameData {
+			if dataLen < 0 {
+				// 没有长度字段时负载为帧尾固定元素之前的全部内容
+				tail := 0
+				for _, rest := range t.tokens[i+1:] {
+					tail += t.fixedSize(rest, devAddr, cmd)
+				}
+				dataLen = len(buf) - pos - tail
+				if dataLen < 0 {
+					return nil, false, ErrIncompleteFrame
+				}
+				inferred = true
+			}
+			size = dataLen
+		}
+		if pos+size > len(buf) {
+			return nil, inferred, ErrIncompleteFrame
+		}
+		field := buf[pos : pos+size]
+		switch tok.kind {
+		case frameLiteral:
+			if !bytes.Equal(field, tok.bytes) {
+				return nil, inferred, fmt.Errorf("帧第%d字节应为%X，收到%X", pos, tok.bytes, field)
+			}
+		case frameAddr:
+			if !bytes.Equal(field, devAddr) {
+				return nil, inferred, fmt.Errorf("响应地址%X与设备地址%X不符", field, devAddr)
+			}
+		case frameCmd:
+			if !bytes.Equal(field, cmd) {
+				return nil, inferred, fmt.Errorf("响应命令%X与请求命令%X不符", field, cmd)
+			}
+		case frameLen:
+			dataLen = t.decodeLength(field) - t.lengthAdjust
+			if dataLen < 0 {
+				return nil, inferred, fmt.Errorf("长度字段%X无效", field)
+			}
+		case frameData:
+			payload = field
+		case frameCRC:
+			want, err := t.spec.Compute(buf[:pos])
+			if err != nil {
+				return nil, inferred, err
+			}
+			if !bytes.Equal(field, want) {
+				return nil, inferred, fmt.Errorf("%s校验错误: 收到%X，计算为%X", t.spec.Algorithm.Name(), field, want)
+			}
+		}
+		pos += size
+	}
+	return payload, false, nil
+}
+
+// GenerateCommands 按请求模板生成命令
+func (p *FrameProtocol) GenerateCommands(dev *modu.EParser) (map[string][]byte, error) {
+	req, _, err := frameTemplates(dev)
+	if err != nil {
+		return nil, err
+	}
+	commands := make(map[string][]byte)
+	for _, addr := range dev.Addrs {
+		cmdKey := p.GenerateKey(dev, addr)
+		if _, ok := commands[cmdKey]; ok {
+			continue
+		}
+		frame, err := req.build(dev, addr)
+		if err != nil {
+			return nil, fmt.Errorf("测点%s: %w", addr.MetricCode, err)
+		}
+		commands[cmdKey] = frame
+	}
+	return commands, nil
+}
+
+func (p *FrameProtocol) GenerateKey(dev *modu.EParser, addr modu.EAddr) string {
+	return fmt.Sprintf("frame@%s@%s", addr.Command, addr.CommandExtra)
+}
+
+// GetCommandAddrs 获取命令对应的测点
+func (p *FrameProtocol) GetCommandAddrs(dev *modu.EParser, commandKey string) (addrs []modu.EAddr) {
+	for _, addr := range dev.Addrs {
+		cmdKey := p.GenerateKey(dev, addr)
+		if cmdKey == commandKey {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+// Send 发送请求帧，读取到符合响应模板的完整帧为止。
+// 响应模板没有长度字段时，在帧尾匹配且校验通过后结束。
+func (p *FrameProtocol) Send(transport core.Transport, sendBuf []byte, dev *modu.EParser) ([]byte, error) {
+	req, resp, err := frameTemplates(dev)
+	if err != nil {
+		return nil, err
+	}
+	// 命令与设备地址用于判断帧是否完整，取自请求帧对应的测点
+	addr, ok := req.requestAddr(p, dev, sendBuf)
+	if !ok {
+		return nil, fmt.Errorf("请求帧%X不是由测点生成的命令", sendBuf)
+	}
+	err = transport.Connect()
+	if err != nil {
+		log.Println("FrameProtocol Send connect err:", err)
+		return nil, err
+	}
+	defer transport.Close()
+
+	err = transport.Write(sendBuf)
+	if err != nil {
+		return nil, fmt.Errorf("write failed: %w", err)
+	}
+	timeout := 1 * time.Second
+	if dev.Dev.RevTimeout > 0 {
+		timeout = time.Duration(dev.Dev.RevTimeout) * time.Millisecond
+	}
+	endTime := time.Now().Add(timeout)
+	var received []byte
+	lastErr := ErrIncompleteFrame
+	for time.Now().Before(endTime) {
+		ctx, cancel := context.WithDeadline(context.Background(), endTime)
+		data, err := transport.ReadWithContext(ctx)
+		cancel()
+		if err != nil {
+			if errors.Is(err, context.DeadlineExceeded) {
+				break
+			}
+			return nil, fmt.Errorf("read error: %w", err)
+		}
+		received = resp.sync(append(received, data...))
+		_, lastErr = resp.parse(received, dev, addr)
+		if lastErr == nil {
+			return received, nil
+		}
+		if !errors.Is(lastErr, ErrIncompleteFrame) {
+			// 完整的帧命令、地址或校验不符，不再等待
+			return received, lastErr
+		}
+	}
+	if len(received) > 0 {
+		return received, fmt.Errorf("frame timeout after %v: %w", timeout, lastErr)
+	}
+	return nil, fmt.Errorf("frame timeout after %v", timeout)
+}
+
+// requestAddr 查找生成该请求帧的测点，同一命令只生成一次
+func (t *frameTemplate) requestAddr(p *FrameProtocol, dev *modu.EParser, sendBuf []byte) (modu.EAddr, bool) {
+	built := make(map[string]bool)
+	for _, addr := range dev.Addrs {
+		cmdKey := p.GenerateKey(dev, addr)
+		if built[cmdKey] {
+			continue
+		}
+		built[cmdKey] = true
+		frame, err := t.build(dev, addr)
+		if err == nil && bytes.Equal(frame, sendBuf) {
+			return addr, true
+		}
+	}
+	return modu.EAddr{}, false
+}
+
+// ParseResponse 校验响应帧并按负载解析测点
+func (p *FrameProtocol) ParseResponse(data []byte, dev *modu.EParser, addrs []modu.EAddr) (map[string]modu.ParseValue, error) {
+	var par parser.HexParser
+	var r = make(map[string]modu.ParseValue)
+	if len(addrs) == 0 {
+		return r, nil
+	}
+	_, resp, err := frameTemplates(dev)
+	if err != nil {
+		return r, err
+	}
+	payload, err := resp.parse(resp.sync(data), dev, addrs[0])
+	if err != nil {
+		return r, err
+	}
+	local := *dev
+	if local.Dev.Encoding == "" {
+		local.Dev.Encoding = parser.EncodingBinary
+	}
+	addrs, err = parser.ExpandGroups(&par, payload, &local, addrs)
+	if err != nil {
+		return r, err
+	}
+	addrs, err = parser.ExpandBits(addrs)
+	if err != nil {
+		return r, err
+	}
+	var errs modu.ParseErrors
+	for _, addr := range addrs {
+		v, perr := parser.Decode(&par, payload, &local, addr)
+		if perr != nil {
+			errs = append(errs, perr)
+		}
+		r[addr.MetricCode] = v
+	}
+	return r, errs.Err()
+}
@@ -0,0 +1,351 @@
+package protocols
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/zoneBen/ProtoHub/checksum"
+	"github.com/zoneBen/ProtoHub/core"
+	"github.com/zoneBen/ProtoHub/modu"
+	"github.com/zoneBen/ProtoHub/parser"
+)
+
+// MegatecProtocol Megatec（Q1）UPS 协议及 Voltronic 扩展（QPIGS、QMOD 等）。
+// EAddr.Command 为查询命令，如 "Q1"、"F"、"I"、"QPIGS"；
+// 响应去掉起始符 '('/'#' 与校验后，MetricIndex 按空格分隔取第几个字段，
+// 或按 StartAt/Length、Pattern 提取（"I" 命令为定长字段），DataType 缺省为 FLOAT。
+// 以 Q 开头且长于两个字符的 Voltronic 命令在请求与响应中带 CRC-XMODEM 校验。
+// EDev.Preset 为 "megatec" 或 "voltronic" 时自动补充内置测点。
+type MegatecProtocol struct {
+	Timeout time.Duration // 单次请求超时，默认 2 秒
+}
+
+// Megatec 控制命令
+const (
+	MegatecTest           = "T"  // 自检 10 秒
+	MegatecTestUntilLow   = "TL" // 自检至电池电压低
+	MegatecCancelShutdown = "C"  // 取消关机
+	MegatecCancelTest     = "CT" // 取消自检
+	MegatecToggleBeeper   = "Q"  // 切换蜂鸣器
+)
+
+// Q1 状态位，b7 为字符串第一位
+const megatecQ1Bits = "7:市电异常:市电异常告警;6:电池电压低:电池电压低告警;5:旁路/升降压工作;4:UPS故障:UPS故障告警;" +
+	"3:后备式UPS;2:自检中;1:关机中;0:蜂鸣器开启"
+
+// megatecField 内置字段，Index 为空格分隔的序号，为 0 时按 StartAt/Length 或 Extra 设置的方式提取
+type megatecField struct {
+	Code     string
+	Name     string
+	Unit     string
+	Index    int
+	StartAt  int
+	Length   int
+	DataType string
+	Extra    func(addr *modu.EAddr)
+}
+
+var megatecPresets = map[string]map[string][]megatecField{
+	"megatec": {
+		"Q1": {
+			{"input_voltage", "输入电压", "V", 1, 0, 0, "", nil},
+			{"input_fault_voltage", "输入故障电压", "V", 2, 0, 0, "", nil},
+			{"output_voltage", "输出电压", "V", 3, 0, 0, "", nil},
+			{"output_load", "输出负载", "%", 4, 0, 0, "", nil},
+			{"input_frequency", "输入频率", "Hz", 5, 0, 0, "", nil},
+			{"battery_voltage", "电池电压", "V", 6, 0, 0, "", nil},
+			{"temperature", "温度", "℃", 7, 0, 0, "", nil},
+			{"status", "UPS状态", "", 8, 0, 0, "BIN2INT", func(a *modu.EAddr) { a.Bits = megatecQ1Bits }},
+		},
+		"F": {
+			{"rating_voltage", "额定电压", "V", 1, 0, 0, "", nil},
+			{"rating_current", "额定电流", "A", 2, 0, 0, "", nil},
+			{"rating_battery_voltage", "额定电池电压", "V", 3, 0, 0, "", nil},
+			{"rating_frequency", "额定频率", "Hz", 4, 0, 0, "", nil},
+		},
+		"I": {
+			// 定长字段 15、10、10 字符，以空格分隔，设备可能省略末尾空格
+			{"company", "厂家名称", "", 0, 0, 0, "ASCII", megatecFixed(0, 15)},
+			{"model", "UPS型号", "", 0, 0, 0, "ASCII", megatecFixed(16, 10)},
+			{"version", "版本", "", 0, 0, 0, "ASCII", megatecFixed(27, 10)},
+		},
+	},
+	"voltronic": {
+		"QPIGS": {
+			{"grid_voltage", "市电电压", "V", 1, 0, 0, "", nil},
+			{"grid_frequency", "市电频率", "Hz", 2, 0, 0, "", nil},
+			{"output_voltage", "输出电压", "V", 3, 0, 0, "", nil},
+			{"output_frequency", "输出频率", "Hz", 4, 0, 0, "", nil},
+			{"output_apparent_power", "输出视在功率", "VA", 5, 0, 0, "", nil},
+			{"output_active_power", "输出有功功率", "W", 6, 0, 0, "", nil},
+			{"output_load", "输出负载", "%", 7, 0, 0, "", nil},
+			{"bus_voltage", "母线电压", "V", 8, 0, 0, "", nil},
+			{"battery_voltage", "电池电压", "V", 9, 0, 0, "", nil},
+			{"battery_charging_current", "电池充电电流", "A", 10, 0, 0, "", nil},
+			{"battery_capacity", "电池容量", "%", 11, 0, 0, "", nil},
+			{"heat_sink_temperature", "散热器温度", "℃", 12, 0, 0, "", nil},
+			{"pv_input_current", "光伏输入电流", "A", 13, 0, 0, "", nil},
+			{"pv_input_voltage", "光伏输入电压", "V", 14, 0, 0, "", nil},
+			{"battery_voltage_scc", "SCC电池电压", "V", 15, 0, 0, "", nil},
+			{"battery_discharge_current", "电池放电电流", "A", 16, 0, 0, "", nil},
+			{"device_status", "设备状态", "", 17, 0, 0, "BIN2INT", func(a *modu.EAddr) {
+				a.Bits = "7:SBU优先版本;6:配置已变更;5:SCC固件已更新;4:负载开启;3:电池电压稳定;2:充电中;1:SCC充电中;0:市电充电中"
+			}},
+		},
+		"QMOD": {
+			{"mode", "工作模式", "", 1, 0, 0, "MAP", func(a *modu.EAddr) {
+				a.ReMap = `{"P":0,"S":1,"L":2,"B":3,"F":4,"H":5,"D":6}`
+				a.EnumStr = "0:上电;1:待机;2:市电;3:电池;4:故障:critical;5:节能;6:关机"
+			}},
+		},
+	},
+}
+
+// megatecFixed 按字符位置截取定长字段，允许末尾字段不足长度
+func megatecFixed(start, length int) func(addr *modu.EAddr) {
+	return func(addr *modu.EAddr) {
+		addr.Pattern = fmt.Sprintf("^.{%d}(.{1,%d})", start, length)
+	}
+}
+
+func (p *MegatecProtocol) timeout() time.Duration {
+	if p.Timeout > 0 {
+		return p.Timeout
+	}
+	return 2 * time.Second
+}
+
+// megatecUsesCRC Voltronic 扩展命令带 CRC
+func megatecUsesCRC(command string) bool {
+	return len(command) > 2 && strings.HasPrefix(command, "Q")
+}
+
+// ExpandPreset 按 EDev.Preset 补充内置测点，已存在同名 MetricCode 的测点保持不变
+func (p *MegatecProtocol) ExpandPreset(dev *modu.EParser) error {
+	if dev.Dev.Preset == "" {
+		return nil
+	}
+	commands, ok := megatecPresets[strings.ToLower(dev.Dev.Preset)]
+	if !ok {
+		return fmt.Errorf("未找到Megatec模板: %s", dev.Dev.Preset)
+	}
+	exists := make(map[string]bool)
+	for _, addr := range dev.Addrs {
+		exists[addr.MetricCode] = true
+	}
+	for _, command := range []string{"Q1", "F", "I", "QPIGS", "QMOD"} {
+		for _, f := range commands[command] {
+			code := strings.ToLower(command) + "_" + f.Code
+			if exists[code] {
+				continue
+			}
+			addr := modu.EAddr{
+				Command:     command,
+				MetricCode:  code,
+				MetricName:  f.Name,
+				MetricUnit:  f.Unit,
+				MetricIndex: f.Index,
+				StartAt:     f.StartAt,
+				Length:      f.Length,
+				DataType:    f.DataType,
+			}
+			if f.Extra != nil {
+				f.Extra(&addr)
+			}
+			exists[code] = true
+			dev.Addrs = append(dev.Addrs, addr)
+		}
+	}
+	return nil
+}
+
+// GenerateCommands 生成命令键与内容的映射
+func (p *MegatecProtocol) GenerateCommands(dev *modu.EParser) (map[string][]byte, error) {
+	if err := p.ExpandPreset(dev); err != nil {
+		return nil, err
+	}
+	commands := make(map[string][]byte)
+	for _, addr := range dev.Addrs {
+		if addr.Command == "" {
+			log.Printf("测点%s未配置命令", addr.MetricName)
+			continue
+		}
+		commands[p.GenerateKey(dev, addr)] = megatecFrame(addr.Command)
+	}
+	return commands, nil
+}
+
+// megatecFrame 命令加校验与回车
+func megatecFrame(command string) []byte {
+	frame := []byte(command)
+	if megatecUsesCRC(command) {
+		frame = append(frame, voltronicCRC(frame)...)
+	}
+	return append(frame, '\r')
+}
+
+func (p *MegatecProtocol) GenerateKey(dev *modu.EParser, addr modu.EAddr) string {
+	return "megatec@" + strings.ToUpper(addr.Command)
+}
+
+// GetCommandAddrs 获取命令对应的测点
+func (p *MegatecProtocol) GetCommandAddrs(dev *modu.EParser, commandKey string) (addrs []modu.EAddr) {
+	for _, addr := range dev.Addrs {
+		cmdKey := p.GenerateKey(dev, addr)
+		if cmdKey == commandKey {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+// Send 发送命令并读取到回车为止
+func (p *MegatecProtocol) Send(transport core.Transport, sendBuf []byte, dev *modu.EParser) ([]byte, error) {
+	err := transport.Connect()
+	if err != nil {
+		log.Println("MegatecProtocol Send connect err:", err)
+		return nil, err
+	}
+	defer transport.Close()
+
+	err = transport.Write(sendBuf)
+	if err != nil {
+		return nil, fmt.Errorf("write failed: %w", err)
+	}
+	endTime := time.Now().Add(p.timeout())
+	var received []byte
+	for time.Now().Before(endTime) {
+		ctx, cancel := context.WithDeadline(context.Background(), endTime)
+		data, err := transport.ReadWithContext(ctx)
+		cancel()
+		if err != nil {
+			if errors.Is(err, context.DeadlineExceeded) {
+				break
+			}
+			return nil, fmt.Errorf("read error: %w", err)
+		}
+		received = append(received, data...)
+		if i := strings.IndexByte(string(received), '\r'); i >= 0 {
+			return received[:i+1], nil
+		}
+	}
+	return nil, fmt.Errorf("megatec timeout after %v", p.timeout())
+}
+
+// Control 发送控制命令，Megatec 控制命令没有响应
+func (p *MegatecProtocol) Control(transport core.Transport, command string) error {
+	err := transport.Connect()
+	if err != nil {
+		return err
+	}
+	defer transport.Close()
+	return transport.Write(megatecFrame(command))
+}
+
+// MegatecTestMinutes 自检 n 分钟（1-99）
+func MegatecTestMinutes(n int) (string, error) {
+	if n < 1 || n > 99 {
+		return "", fmt.Errorf("自检时间%d分钟超出范围1-99", n)
+	}
+	return fmt.Sprintf("T%02d", n), nil
+}
+
+// MegatecShutdown 延时关机，minutes 为 0.2-0.9 或 1-10 分钟；restore 大于 0 时关机后 restore 分钟恢复供电（1-9999）
+func MegatecShutdown(minutes float64, restore int) (string, error) {
+	var cmd string
+	switch {
+	case minutes >= 0.2 && minutes < 1:
+		cmd = fmt.Sprintf("S.%d", int(minutes*10+0.5))
+	case minutes >= 1 && minutes <= 10 && minutes == float64(int(minutes)):
+		cmd = fmt.Sprintf("S%02d", int(minutes))
+	default:
+		return "", fmt.Errorf("关机延时%v分钟无效", minutes)
+	}
+	if restore > 0 {
+		if restore > 9999 {
+			return "", fmt.Errorf("恢复时间%d分钟超出范围1-9999", restore)
+		}
+		cmd += fmt.Sprintf("R%04d", restore)
+	}
+	return cmd, nil
+}
+
+// megatecBody 去掉起始符、校验与回车，返回字段内容
+func megatecBody(data []byte, command string) (string, error) {
+	s := strings.TrimRight(string(data), "\r\n")
+	// 部分设备的 Voltronic 响应不带校验，末尾两字节均可打印时视为无校验
+	if megatecUsesCRC(command) && len(s) >= 3 {
+		body, crc := s[:len(s)-2], s[len(s)-2:]
+		if string(voltronicCRC([]byte(body))) == crc {
+			s = body
+		} else if !isPrintable(crc) {
+			return "", errors.New("megatec crc mismatch")
+		}
+	}
+	if strings.HasPrefix(s, "(NAK") {
+		return "", fmt.Errorf("megatec command %s not acknowledged", command)
+	}
+	if s == "" || s[0] != '(' && s[0] != '#' {
+		return "", errors.New("invalid megatec response")
+	}
+	return s[1:], nil
+}
+
+// ParseResponse 解析响应数据
+func (p *MegatecProtocol) ParseResponse(data []byte, dev *modu.EParser, addrs []modu.EAddr) (map[string]modu.ParseValue, error) {
+	var r = make(map[string]modu.ParseValue)
+	if len(addrs) == 0 {
+		return r, nil
+	}
+	body, err := megatecBody(data, strings.ToUpper(addrs[0].Command))
+	if err != nil {
+		return r, err
+	}
+	addrs, err = parser.ExpandBits(addrs)
+	if err != nil {
+		return r, err
+	}
+	// 字段以单个空格分隔，前缀已去除
+	local := *dev
+	local.Dev.Separator = " "
+	local.Dev.RevPre = ""
+	var par parser.SimpleParser
+	var errs modu.ParseErrors
+	for _, addr := range addrs {
+		if addr.DataType == "" {
+			addr.DataType = "FLOAT"
+		}
+		v, perr := parser.Decode(&par, []byte(body), &local, addr)
+		if perr != nil {
+			errs = append(errs, perr)
+		}
+		r[addr.MetricCode] = v
+	}
+	return r, errs.Err()
+}
+
+func isPrintable(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < 0x20 || s[i] > 0x7E {
+			return false
+		}
+	}
+	return true
+}
+
+// voltronicCRC CRC-XMODEM，结果字节若为 '('、'\r'、'\n' 则加一
+func voltronicCRC(data []byte) []byte {
+	out := xmodemChecksum.Encode(xmodemChecksum.Algorithm.Sum(data))
+	for i, b := range out {
+		if b == 0x28 || b == 0x0D || b == 0x0A {
+			out[i]++
+		}
+	}
+	return out
+}
+
+var xmodemChecksum = &checksum.Spec{Algorithm: mustChecksum(checksum.CRC16XModem), Order: checksum.OrderBE}
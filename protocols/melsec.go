@@ -0,0 +1,153 @@
+package protocols
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/zoneBen/ProtoHub/core"
+	"github.com/zoneBen/ProtoHub/modu"
+)
+
+// MCProtocol 三菱 MC 协议 3E 帧（二进制）读取协议。
+// EAddr.Command 为软元件加地址，如 "D100"、"W1A0"、"M16"，X/Y/B/W 地址为十六进制；
+// 位软元件按字读取，地址应为 16 的倍数。缺省数据类型 UINT16，缺省字节序 BA（小端）。
+type MCProtocol struct {
+	MaxWords int           // 单次读取的最大字数，默认 960
+	Timeout  time.Duration // 单次请求超时，默认 3 秒
+}
+
+var mcAreas = map[string]plcArea{
+	"D":  {Code: 0xA8},
+	"SD": {Code: 0xA9},
+	"W":  {Code: 0xB4, Hex: true},
+	"SW": {Code: 0xB5, Hex: true},
+	"R":  {Code: 0xAF},
+	"ZR": {Code: 0xB0},
+	"TN": {Code: 0xC2},
+	"CN": {Code: 0xC5},
+	"X":  {Code: 0x9C, Hex: true, Bit: true},
+	"Y":  {Code: 0x9D, Hex: true, Bit: true},
+	"M":  {Code: 0x90, Bit: true},
+	"L":  {Code: 0x92, Bit: true},
+	"B":  {Code: 0xA0, Hex: true, Bit: true},
+	"SM": {Code: 0x91, Bit: true},
+}
+
+const (
+	mcRespHeaderLen = 9  // 副帧头至请求数据长
+	mcDataOffset    = 11 // 含结束代码
+)
+
+func (p *MCProtocol) maxWords() int {
+	if p.MaxWords > 0 {
+		return p.MaxWords
+	}
+	return 960
+}
+
+func (p *MCProtocol) timeout() time.Duration {
+	if p.Timeout > 0 {
+		return p.Timeout
+	}
+	return 3 * time.Second
+}
+
+// GenerateCommands 生成命令键与内容的映射，使用批量读取（字单位）0401/0000
+func (p *MCProtocol) GenerateCommands(dev *modu.EParser) (map[string][]byte, error) {
+	commands := make(map[string][]byte)
+	for _, addr := range dev.Addrs {
+		if _, _, err := parsePLCPoint(addr, mcAreas); err != nil {
+			log.Printf("测点%s配置错误: %v", addr.MetricName, err)
+			return nil, err
+		}
+	}
+	for _, block := range plcBlocks(dev, mcAreas, p.maxWords()) {
+		if _, ok := commands[block.key()]; ok {
+			continue
+		}
+		frame := []byte{
+			0x50, 0x00, // 副帧头
+			0x00,       // 网络编号
+			0xFF,       // PLC 编号
+			0xFF, 0x03, // 请求目标模块 I/O 编号
+			0x00,       // 请求目标模块站号
+			0x0C, 0x00, // 请求数据长
+			0x10, 0x00, // 监视定时器 4 秒
+			0x01, 0x04, // 批量读取
+			0x00, 0x00, // 字单位
+			byte(block.Start), byte(block.Start >> 8), byte(block.Start >> 16),
+			mcAreas[block.Area].Code,
+			byte(block.Words), byte(block.Words >> 8),
+		}
+		commands[block.key()] = frame
+	}
+	return commands, nil
+}
+
+func (p *MCProtocol) GenerateKey(dev *modu.EParser, addr modu.EAddr) string {
+	return plcKey(plcBlocks(dev, mcAreas, p.maxWords()), addr, mcAreas)
+}
+
+// GetCommandAddrs 获取命令对应的测点
+func (p *MCProtocol) GetCommandAddrs(dev *modu.EParser, commandKey string) []modu.EAddr {
+	return plcCommandAddrs(dev, mcAreas, p.maxWords(), commandKey)
+}
+
+// Send 发送命令并按响应头中的数据长读取完整帧
+func (p *MCProtocol) Send(transport core.Transport, sendBuf []byte, dev *modu.EParser) ([]byte, error) {
+	err := transport.Connect()
+	if err != nil {
+		log.Println("MCProtocol Send connect err:", err)
+		return nil, err
+	}
+	defer transport.Close()
+
+	err = transport.Write(sendBuf)
+	if err != nil {
+		return nil, fmt.Errorf("write failed: %w", err)
+	}
+	endTime := time.Now().Add(p.timeout())
+	var received []byte
+	for time.Now().Before(endTime) {
+		ctx, cancel := context.WithDeadline(context.Background(), endTime)
+		data, err := transport.ReadWithContext(ctx)
+		cancel()
+		if err != nil {
+			if errors.Is(err, context.DeadlineExceeded) {
+				break
+			}
+			return nil, fmt.Errorf("read error: %w", err)
+		}
+		received = append(received, data...)
+		if len(received) >= mcRespHeaderLen {
+			if received[0] != 0xD0 || received[1] != 0x00 {
+				return nil, errors.New("invalid mc response header")
+			}
+			total := mcRespHeaderLen + int(binary.LittleEndian.Uint16(received[7:]))
+			if len(received) >= total {
+				return received[:total], nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("mc timeout after %v", p.timeout())
+}
+
+// ParseResponse 解析响应数据
+func (p *MCProtocol) ParseResponse(data []byte, dev *modu.EParser, addrs []modu.EAddr) (map[string]modu.ParseValue, error) {
+	if len(data) < mcDataOffset || data[0] != 0xD0 {
+		return plcFailAll(addrs, errors.New("invalid mc response"))
+	}
+	if end := binary.LittleEndian.Uint16(data[9:]); end != 0 {
+		return plcFailAll(addrs, fmt.Errorf("mc end code 0x%04X", end))
+	}
+	return plcParseWords(data[mcDataOffset:], dev, addrs, mcAreas, mcByteOrder)
+}
+
+// mcByteOrder 二进制通信时字及多字数据均为低位在前
+func mcByteOrder(size int) string {
+	return "BA"
+}
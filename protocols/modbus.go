@@ -0,0 +1,496 @@
+package protocols
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zoneBen/ProtoHub/core"
+	"github.com/zoneBen/ProtoHub/modu"
+	"github.com/zoneBen/ProtoHub/parser"
+)
+
+// Modbus 读取功能码
+const (
+	ModbusReadCoils            byte = 0x01
+	ModbusReadDiscreteInputs   byte = 0x02
+	ModbusReadHoldingRegisters byte = 0x03
+	ModbusReadInputRegisters   byte = 0x04
+)
+
+// 单次读取的最大数量（协议规定）
+const (
+	modbusMaxRegisters = 125
+	modbusMaxBits      = 2000
+)
+
+// ModbusException 从站返回的异常响应
+type ModbusException struct {
+	Function byte
+	Code     byte
+}
+
+var modbusExceptionText = map[byte]string{
+	0x01: "非法功能码",
+	0x02: "非法数据地址",
+	0x03: "非法数据值",
+	0x04: "从站设备故障",
+	0x05: "确认，处理中",
+	0x06: "从站设备忙",
+	0x08: "存储奇偶性差错",
+	0x0A: "网关路径不可用",
+	0x0B: "网关目标设备响应失败",
+}
+
+func (e *ModbusException) Error() string {
+	text, ok := modbusExceptionText[e.Code]
+	if !ok {
+		text = "未知异常"
+	}
+	return fmt.Sprintf("modbus功能码0x%02X异常0x%02X: %s", e.Function, e.Code, text)
+}
+
+// modbusPoint 测点在从站中的位置，线圈与离散输入以位计，寄存器以字计
+type modbusPoint struct {
+	Function byte
+	Address  int
+	Count    int
+}
+
+// modbusBlock 一次读取的连续区域
+type modbusBlock struct {
+	Function byte
+	Start    int
+	Count    int
+}
+
+func (b modbusBlock) key() string {
+	return fmt.Sprintf("modbus@%02X@%d@%d", b.Function, b.Start, b.Count)
+}
+
+// modbusBitFunction 按位读取的功能码
+func modbusBitFunction(fc byte) bool {
+	return fc == ModbusReadCoils || fc == ModbusReadDiscreteInputs
+}
+
+func modbusMaxCount(fc byte) int {
+	if modbusBitFunction(fc) {
+		return modbusMaxBits
+	}
+	return modbusMaxRegisters
+}
+
+// modbusDataType 测点的数据类型，寄存器缺省 UINT16，线圈与离散输入缺省 BOOL
+func modbusDataType(addr modu.EAddr, fc byte) string {
+	if addr.DataType != "" {
+		return addr.DataType
+	}
+	if modbusBitFunction(fc) {
+		return "BOOL"
+	}
+	return plcDefaultDataType
+}
+
+// parseModbusPoint EAddr.Command 为功能码（十六进制，如 "03"），StartAt 为起始地址（从 0 开始），
+// 寄存器测点的寄存器数由数据类型决定，未知类型取 Length；线圈与离散输入每个测点一位
+func parseModbusPoint(addr modu.EAddr) (modbusPoint, error) {
+	fc, err := getByte(addr.Command)
+	if err != nil {
+		return modbusPoint{}, fmt.Errorf("modbus功能码%q无效: %w", addr.Command, err)
+	}
+	switch fc {
+	case ModbusReadCoils, ModbusReadDiscreteInputs, ModbusReadHoldingRegisters, ModbusReadInputRegisters:
+	default:
+		return modbusPoint{}, fmt.Errorf("不支持的modbus读取功能码0x%02X", fc)
+	}
+	if addr.StartAt < 0 || addr.StartAt > 0xFFFF {
+		return modbusPoint{}, fmt.Errorf("modbus地址%d超出范围", addr.StartAt)
+	}
+	point := modbusPoint{Function: fc, Address: addr.StartAt, Count: 1}
+	if !modbusBitFunction(fc) {
+		size := parser.DataTypeSize(modbusDataType(addr, fc))
+		if size == 0 {
+			size = 2
+			if addr.Length > 0 {
+				size = addr.Length * 2
+			}
+		}
+		point.Count = (size + 1) / 2
+	}
+	if point.Count > modbusMaxCount(fc) {
+		return modbusPoint{}, fmt.Errorf("modbus测点%s长度%d超出单次读取上限", addr.MetricCode, point.Count)
+	}
+	return point, nil
+}
+
+func (pt modbusPoint) key() string {
+	return fmt.Sprintf("%02X@%d@%d", pt.Function, pt.Address, pt.Count)
+}
+
+// modbusRange 禁止读取的地址范围，Function 为 0 时适用于所有功能码
+type modbusRange struct {
+	Function byte
+	Start    int
+	End      int // 含
+}
+
+// parseForbiddenRanges 解析 "起始-结束" 或 "功能码:起始-结束" 以分号分隔的地址范围，单个地址可省略结束
+func parseForbiddenRanges(s string) ([]modbusRange, error) {
+	var ranges []modbusRange
+	for _, item := range strings.Split(s, ";") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		var r modbusRange
+		span := item
+		if i := strings.Index(item, ":"); i >= 0 {
+			fc, err := getByte(strings.TrimSpace(item[:i]))
+			if err != nil {
+				return nil, fmt.Errorf("禁止范围%q的功能码无效", item)
+			}
+			r.Function, span = fc, item[i+1:]
+		}
+		bounds := strings.SplitN(span, "-", 2)
+		var err error
+		if r.Start, err = strconv.Atoi(strings.TrimSpace(bounds[0])); err != nil {
+			return nil, fmt.Errorf("禁止范围%q无效", item)
+		}
+		r.End = r.Start
+		if len(bounds) == 2 {
+			if r.End, err = strconv.Atoi(strings.TrimSpace(bounds[1])); err != nil {
+				return nil, fmt.Errorf("禁止范围%q无效", item)
+			}
+		}
+		if r.Start < 0 || r.End < r.Start {
+			return nil, fmt.Errorf("禁止范围%q无效", item)
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges, nil
+}
+
+// modbusReadLimits 设备的合并读取限制
+type modbusReadLimits struct {
+	max       int
+	gap       int
+	forbidden []modbusRange
+}
+
+func newModbusReadLimits(dev *modu.EParser) (modbusReadLimits, error) {
+	if dev.Dev.MaxRegisters < 0 || dev.Dev.GapTolerance < 0 {
+		return modbusReadLimits{}, errors.New("MaxRegisters与GapTolerance不能为负数")
+	}
+	forbidden, err := parseForbiddenRanges(dev.Dev.ForbiddenRanges)
+	if err != nil {
+		return modbusReadLimits{}, err
+	}
+	return modbusReadLimits{max: dev.Dev.MaxRegisters, gap: dev.Dev.GapTolerance, forbidden: forbidden}, nil
+}
+
+// maxCount 功能码的单次读取上限，不超过协议上限
+func (l modbusReadLimits) maxCount(fc byte) int {
+	if max := modbusMaxCount(fc); l.max <= 0 || l.max > max {
+		return max
+	}
+	return l.max
+}
+
+// allowed 区域 [start, end) 不包含禁止读取的地址
+func (l modbusReadLimits) allowed(fc byte, start, end int) bool {
+	if start >= end {
+		return true
+	}
+	for _, r := range l.forbidden {
+		if (r.Function == 0 || r.Function == fc) && start <= r.End && r.Start < end {
+			return false
+		}
+	}
+	return true
+}
+
+// modbusBlocks 将同一功能码下的测点按地址顺序合并为读取块，返回测点键到块的映射。
+// 相邻测点间未配置的地址不超过 GapTolerance 时一并读取，块长度不超过 MaxRegisters，
+// 跨越的空隙不能包含禁止读取的地址；测点本身位于禁止范围内时单独读取。
+func modbusBlocks(dev *modu.EParser) map[string]modbusBlock {
+	limits, err := newModbusReadLimits(dev)
+	if err != nil {
+		limits = modbusReadLimits{}
+	}
+	byFunc := make(map[byte][]modbusPoint)
+	for _, addr := range dev.Addrs {
+		point, err := parseModbusPoint(addr)
+		if err != nil {
+			continue
+		}
+		byFunc[point.Function] = append(byFunc[point.Function], point)
+	}
+	blocks := make(map[string]modbusBlock)
+	for fc, points := range byFunc {
+		sort.Slice(points, func(i, j int) bool { return points[i].Address < points[j].Address })
+		max := limits.maxCount(fc)
+		var members []modbusPoint
+		var cur modbusBlock
+		isolated := false
+		flush := func() {
+			for _, m := range members {
+				blocks[m.key()] = cur
+			}
+			members = nil
+		}
+		for _, pt := range points {
+			forbidden := !limits.allowed(fc, pt.Address, pt.Address+pt.Count)
+			end := pt.Address + pt.Count - cur.Start
+			if len(members) > 0 && !forbidden && !isolated &&
+				pt.Address <= cur.Start+cur.Count+limits.gap && (end <= max || end <= cur.Count) &&
+				limits.allowed(fc, cur.Start+cur.Count, pt.Address) {
+				if end > cur.Count {
+					cur.Count = end
+				}
+				members = append(members, pt)
+				continue
+			}
+			flush()
+			cur = modbusBlock{Function: fc, Start: pt.Address, Count: pt.Count}
+			members = append(members, pt)
+			isolated = forbidden
+		}
+		flush()
+	}
+	return blocks
+}
+
+// modbusBlockOf 在 modbusBlocks 的结果中查找测点所在的读取块
+func modbusBlockOf(blocks map[string]modbusBlock, addr modu.EAddr) (modbusBlock, error) {
+	point, err := parseModbusPoint(addr)
+	if err != nil {
+		return modbusBlock{}, err
+	}
+	block, ok := blocks[point.key()]
+	if !ok {
+		return modbusBlock{}, fmt.Errorf("modbus point %s not found", addr.MetricCode)
+	}
+	return block, nil
+}
+
+// modbusSlave 从站地址取 EDev.Addr（十六进制），为空时为 1
+func modbusSlave(dev *modu.EParser) (byte, error) {
+	if dev.Dev.Addr == "" {
+		return 1, nil
+	}
+	return getByte(dev.Dev.Addr)
+}
+
+// modbusFramer RTU 与 ASCII 的帧格式
+type modbusFramer interface {
+	// encode 将从站地址与 PDU 封装为完整帧
+	encode(slave byte, pdu []byte) []byte
+	// frameLen 判断帧是否接收完整，返回完整帧长度，未完整时返回 0
+	frameLen(buf []byte) (int, error)
+	// decode 校验完整帧，返回从站地址与 PDU
+	decode(frame []byte) (byte, []byte, error)
+}
+
+// modbusCommands 为每个读取块生成请求
+func modbusCommands(dev *modu.EParser, framer modbusFramer) (map[string][]byte, error) {
+	for _, addr := range dev.Addrs {
+		if _, err := parseModbusPoint(addr); err != nil {
+			log.Printf("测点%s配置错误: %v", addr.MetricName, err)
+			return nil, err
+		}
+	}
+	if _, err := newModbusReadLimits(dev); err != nil {
+		return nil, err
+	}
+	slave, err := modbusSlave(dev)
+	if err != nil {
+		return nil, err
+	}
+	commands := make(map[string][]byte)
+	for _, block := range modbusBlocks(dev) {
+		pdu := []byte{block.Function, byte(block.Start >> 8), byte(block.Start), byte(block.Count >> 8), byte(block.Count)}
+		commands[block.key()] = framer.encode(slave, pdu)
+	}
+	return commands, nil
+}
+
+func modbusKey(blocks map[string]modbusBlock, addr modu.EAddr) string {
+	block, err := modbusBlockOf(blocks, addr)
+	if err != nil {
+		return ""
+	}
+	return block.key()
+}
+
+func modbusCommandAddrs(dev *modu.EParser, commandKey string) (addrs []modu.EAddr) {
+	blocks := modbusBlocks(dev)
+	for _, addr := range dev.Addrs {
+		if modbusKey(blocks, addr) == commandKey {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+// modbusTimeout 响应超时取 EDev.RevTimeout，未配置时为 fallback，再缺省为 1 秒
+func modbusTimeout(dev *modu.EParser, fallback time.Duration) time.Duration {
+	if dev.Dev.RevTimeout > 0 {
+		return time.Duration(dev.Dev.RevTimeout) * time.Millisecond
+	}
+	if fallback > 0 {
+		return fallback
+	}
+	return time.Second
+}
+
+// modbusSend 发送请求并按帧格式读取完整响应
+func modbusSend(transport core.Transport, sendBuf []byte, framer modbusFramer, timeout time.Duration) ([]byte, error) {
+	err := transport.Connect()
+	if err != nil {
+		log.Println("Modbus Send connect err:", err)
+		return nil, err
+	}
+	defer transport.Close()
+
+	err = transport.Write(sendBuf)
+	if err != nil {
+		return nil, fmt.Errorf("write failed: %w", err)
+	}
+	endTime := time.Now().Add(timeout)
+	var received []byte
+	for time.Now().Before(endTime) {
+		ctx, cancel := context.WithDeadline(context.Background(), endTime)
+		data, err := transport.ReadWithContext(ctx)
+		cancel()
+		if err != nil {
+			if errors.Is(err, context.DeadlineExceeded) {
+				break
+			}
+			return nil, fmt.Errorf("read error: %w", err)
+		}
+		received = append(received, data...)
+		n, err := framer.frameLen(received)
+		if err != nil {
+			return nil, err
+		}
+		if n > 0 {
+			return received[:n], nil
+		}
+	}
+	return nil, fmt.Errorf("modbus timeout after %v", timeout)
+}
+
+// modbusPDULen 响应 PDU 的长度，数据不足时返回 0
+func modbusPDULen(pdu []byte) int {
+	if len(pdu) < 2 {
+		return 0
+	}
+	switch {
+	case pdu[0]&0x80 != 0:
+		return 2
+	case pdu[0] == ModbusWriteSingleCoil || pdu[0] == ModbusWriteSingleRegister ||
+		pdu[0] == ModbusWriteMultipleCoils || pdu[0] == ModbusWriteMultipleRegisters:
+		return 5
+	}
+	return 2 + int(pdu[1])
+}
+
+// modbusPayload 校验响应 PDU 与请求是否对应，返回数据部分，异常响应返回 *ModbusException
+func modbusPayload(pdu []byte, block modbusBlock) ([]byte, error) {
+	if len(pdu) < 2 {
+		return nil, errors.New("modbus响应过短")
+	}
+	if pdu[0] == block.Function|0x80 {
+		return nil, &ModbusException{Function: block.Function, Code: pdu[1]}
+	}
+	if pdu[0] != block.Function {
+		return nil, fmt.Errorf("modbus响应功能码0x%02X与请求0x%02X不符", pdu[0], block.Function)
+	}
+	want := block.Count * 2
+	if modbusBitFunction(block.Function) {
+		want = (block.Count + 7) / 8
+	}
+	if int(pdu[1]) != want || len(pdu) < 2+want {
+		return nil, fmt.Errorf("modbus响应字节数%d，应为%d", pdu[1], want)
+	}
+	return pdu[2 : 2+want], nil
+}
+
+// modbusParse 校验响应帧并解析测点
+func modbusParse(data []byte, dev *modu.EParser, addrs []modu.EAddr, framer modbusFramer) (map[string]modu.ParseValue, error) {
+	var r = make(map[string]modu.ParseValue)
+	if len(addrs) == 0 {
+		return r, nil
+	}
+	block, err := modbusBlockOf(modbusBlocks(dev), addrs[0])
+	if err != nil {
+		return r, err
+	}
+	slave, pdu, err := framer.decode(data)
+	if err != nil {
+		return r, err
+	}
+	if want, err := modbusSlave(dev); err == nil && slave != want {
+		return r, fmt.Errorf("modbus响应从站地址%d与请求%d不符", slave, want)
+	}
+	payload, err := modbusPayload(pdu, block)
+	if err != nil {
+		return r, err
+	}
+	return modbusParsePoints(payload, block, dev, addrs)
+}
+
+// modbusParsePoints 按测点位置解析块数据
+func modbusParsePoints(payload []byte, block modbusBlock, dev *modu.EParser, addrs []modu.EAddr) (map[string]modu.ParseValue, error) {
+	var par parser.HexParser
+	var r = make(map[string]modu.ParseValue)
+	var errs modu.ParseErrors
+	addrs, err := parser.ExpandBits(addrs)
+	if err != nil {
+		return r, err
+	}
+	for _, addr := range addrs {
+		v, perr := modbusDecode(&par, payload, block, dev, addr)
+		if perr != nil {
+			errs = append(errs, perr)
+		}
+		r[addr.MetricCode] = v
+	}
+	return r, errs.Err()
+}
+
+func modbusDecode(par *parser.HexParser, payload []byte, block modbusBlock, dev *modu.EParser, addr modu.EAddr) (modu.ParseValue, *modu.PointError) {
+	point, err := parseModbusPoint(addr)
+	if err != nil {
+		return parser.Failed(addr, modu.QualityExtractFailed, err)
+	}
+	var buf []byte
+	if modbusBitFunction(block.Function) {
+		i := point.Address - block.Start
+		if i < 0 || i/8 >= len(payload) {
+			return parser.Failed(addr, modu.QualityExtractFailed, fmt.Errorf("地址%d不在读取范围内", point.Address))
+		}
+		buf = []byte{payload[i/8] >> (i % 8) & 1}
+	} else {
+		off := (point.Address - block.Start) * 2
+		size := point.Count * 2
+		if off < 0 || off+size > len(payload) {
+			return parser.Failed(addr, modu.QualityExtractFailed, fmt.Errorf("数据长度不足: 需要%d字节, 实际%d字节", off+size, len(payload)))
+		}
+		buf = payload[off : off+size]
+	}
+	decodeAddr := addr
+	decodeAddr.DataType = modbusDataType(addr, block.Function)
+	decodeAddr.Encoding = parser.EncodingBinary
+	v, err := par.Parse(buf, dev, decodeAddr)
+	if err != nil {
+		return parser.Failed(addr, modu.QualityDecodeFailed, err)
+	}
+	v.Addr = addr
+	return parser.CheckRange(v)
+}
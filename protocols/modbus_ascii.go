@@ -0,0 +1,84 @@
+package protocols
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/zoneBen/ProtoHub/checksum"
+	"github.com/zoneBen/ProtoHub/core"
+	"github.com/zoneBen/ProtoHub/modu"
+)
+
+// ModbusASCIIProtocol Modbus ASCII 读取协议，帧为 ':' + 十六进制文本（从站地址 + PDU + LRC）+ CRLF。
+// 测点配置与 ModbusRTUProtocol 相同。
+type ModbusASCIIProtocol struct {
+	Timeout time.Duration // 设备未配置 RevTimeout 时的响应超时，默认 1 秒
+}
+
+var modbusLRC = &checksum.Spec{Algorithm: mustChecksum(checksum.LRC)}
+
+type modbusASCIIFramer struct{}
+
+func (modbusASCIIFramer) encode(slave byte, pdu []byte) []byte {
+	body, _ := modbusLRC.Append(append([]byte{slave}, pdu...))
+	frame := []byte{':'}
+	frame = append(frame, bytes.ToUpper([]byte(hex.EncodeToString(body)))...)
+	return append(frame, '\r', '\n')
+}
+
+func (modbusASCIIFramer) frameLen(buf []byte) (int, error) {
+	start := bytes.IndexByte(buf, ':')
+	if start < 0 {
+		return 0, nil
+	}
+	if i := bytes.Index(buf[start:], []byte("\r\n")); i >= 0 {
+		return start + i + 2, nil
+	}
+	return 0, nil
+}
+
+func (modbusASCIIFramer) decode(frame []byte) (byte, []byte, error) {
+	start := bytes.IndexByte(frame, ':')
+	if start < 0 {
+		return 0, nil, errors.New("modbus ascii响应缺少起始符")
+	}
+	text := bytes.TrimRight(frame[start+1:], "\r\n")
+	body, err := hex.DecodeString(string(text))
+	if err != nil {
+		return 0, nil, fmt.Errorf("modbus ascii响应不是十六进制文本: %w", err)
+	}
+	if body, err = modbusLRC.Verify(body, 0); err != nil {
+		return 0, nil, err
+	}
+	if len(body) < 3 {
+		return 0, nil, errors.New("modbus响应过短")
+	}
+	return body[0], body[1:], nil
+}
+
+// GenerateCommands 生成命令键与内容的映射
+func (p *ModbusASCIIProtocol) GenerateCommands(dev *modu.EParser) (map[string][]byte, error) {
+	return modbusCommands(dev, modbusASCIIFramer{})
+}
+
+func (p *ModbusASCIIProtocol) GenerateKey(dev *modu.EParser, addr modu.EAddr) string {
+	return modbusKey(modbusBlocks(dev), addr)
+}
+
+// GetCommandAddrs 获取命令对应的测点
+func (p *ModbusASCIIProtocol) GetCommandAddrs(dev *modu.EParser, commandKey string) []modu.EAddr {
+	return modbusCommandAddrs(dev, commandKey)
+}
+
+// Send 发送请求并读取到 CRLF 为止
+func (p *ModbusASCIIProtocol) Send(transport core.Transport, sendBuf []byte, dev *modu.EParser) ([]byte, error) {
+	return modbusSend(transport, sendBuf, modbusASCIIFramer{}, modbusTimeout(dev, p.Timeout))
+}
+
+// ParseResponse 解析响应数据
+func (p *ModbusASCIIProtocol) ParseResponse(data []byte, dev *modu.EParser, addrs []modu.EAddr) (map[string]modu.ParseValue, error) {
+	return modbusParse(data, dev, addrs, modbusASCIIFramer{})
+}
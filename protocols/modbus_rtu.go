@@ -0,0 +1,74 @@
+package protocols
+
+import (
+	"errors"
+	"time"
+
+	"github.com/zoneBen/ProtoHub/checksum"
+	"github.com/zoneBen/ProtoHub/core"
+	"github.com/zoneBen/ProtoHub/modu"
+)
+
+// ModbusRTUProtocol Modbus RTU 读取协议，帧为 从站地址 + PDU + CRC16（低字节在前）。
+// EAddr.Command 为功能码（01、02、03、04），StartAt 为起始地址（从 0 开始），
+// 寄存器数按数据类型计算（缺省 UINT16，未知类型取 Length），缺省字节序 AB；
+// 同一功能码下的测点按 EDev 的 MaxRegisters、GapTolerance、ForbiddenRanges 合并读取。
+// EDev.Addr 为从站地址（十六进制），默认 01。
+type ModbusRTUProtocol struct {
+	Timeout time.Duration // 设备未配置 RevTimeout 时的响应超时，默认 1 秒
+}
+
+var modbusCRC = &checksum.Spec{Algorithm: mustChecksum(checksum.CRC16Modbus)}
+
+type modbusRTUFramer struct{}
+
+func (modbusRTUFramer) encode(slave byte, pdu []byte) []byte {
+	frame, _ := modbusCRC.Append(append([]byte{slave}, pdu...))
+	return frame
+}
+
+func (modbusRTUFramer) frameLen(buf []byte) (int, error) {
+	if len(buf) < 1 {
+		return 0, nil
+	}
+	n := modbusPDULen(buf[1:])
+	if n == 0 || len(buf) < 1+n+2 {
+		return 0, nil
+	}
+	return 1 + n + 2, nil
+}
+
+func (modbusRTUFramer) decode(frame []byte) (byte, []byte, error) {
+	body, err := modbusCRC.Verify(frame, 0)
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(body) < 3 {
+		return 0, nil, errors.New("modbus响应过短")
+	}
+	return body[0], body[1:], nil
+}
+
+// GenerateCommands 生成命令键与内容的映射
+func (p *ModbusRTUProtocol) GenerateCommands(dev *modu.EParser) (map[string][]byte, error) {
+	return modbusCommands(dev, modbusRTUFramer{})
+}
+
+func (p *ModbusRTUProtocol) GenerateKey(dev *modu.EParser, addr modu.EAddr) string {
+	return modbusKey(modbusBlocks(dev), addr)
+}
+
+// GetCommandAddrs 获取命令对应的测点
+func (p *ModbusRTUProtocol) GetCommandAddrs(dev *modu.EParser, commandKey string) []modu.EAddr {
+	return modbusCommandAddrs(dev, commandKey)
+}
+
+// Send 发送请求并按响应长度读取完整帧
+func (p *ModbusRTUProtocol) Send(transport core.Transport, sendBuf []byte, dev *modu.EParser) ([]byte, error) {
+	return modbusSend(transport, sendBuf, modbusRTUFramer{}, modbusTimeout(dev, p.Timeout))
+}
+
+// ParseResponse 解析响应数据
+func (p *ModbusRTUProtocol) ParseResponse(data []byte, dev *modu.EParser, addrs []modu.EAddr) (map[string]modu.ParseValue, error) {
+	return modbusParse(data, dev, addrs, modbusRTUFramer{})
+}
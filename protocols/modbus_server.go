@@ -0,0 +1,402 @@
+package protocols
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zoneBen/ProtoHub/core"
+	"github.com/zoneBen/ProtoHub/modu"
+	"github.com/zoneBen/ProtoHub/parser"
+)
+
+// Modbus 服务端寄存器表
+const (
+	ModbusTableHolding = "holding"
+	ModbusTableInput   = "input"
+)
+
+// ModbusServer 将采集到的测点值按映射表以保持寄存器/输入寄存器对外提供，支持 Modbus TCP 与 RTU。
+// 测点缺失或质量异常时对应寄存器为 0xFFFF，未映射的寄存器为 0。
+// 映射配置了 Hmi 时允许写保持寄存器（功能码 6、16），写入值换算为工程值后通过 Write 转发到设备。
+// 一次写入涉及多个测点时先用 Check 检查全部写入，再逐个转发；转发不是原子的，
+// 中途失败时之前的测点已写入设备，客户端收到异常码 04。
+type ModbusServer struct {
+	SlaveID byte                                  // 从站地址，0 表示响应任意地址
+	Write   func(hmi string, value float64) error // 写入转发，为 nil 时拒绝写入，可使用 HmiWriter
+	Check   func(hmi string, value float64) error // 转发前的检查，任一写入不通过时整个请求不转发，可使用 HmiChecker
+
+	maps   []modbusServerMap
+	mu     sync.RWMutex
+	values map[string]modu.ParseValue
+}
+
+type modbusServerMap struct {
+	modu.EModbusMap
+	count int // 寄存器数
+}
+
+func (m modbusServerMap) end() int { return m.Address + m.count }
+
+// NewModbusServer 校验映射表并创建服务端，同一寄存器表内的映射不能重叠
+func NewModbusServer(mappings []modu.EModbusMap) (*ModbusServer, error) {
+	s := &ModbusServer{values: make(map[string]modu.ParseValue)}
+	for _, m := range mappings {
+		m.Table = strings.ToLower(m.Table)
+		if m.Table == "" {
+			m.Table = ModbusTableHolding
+		}
+		if m.Table != ModbusTableHolding && m.Table != ModbusTableInput {
+			return nil, fmt.Errorf("映射%s的寄存器表%q无效", m.MetricCode, m.Table)
+		}
+		if m.DataType == "" {
+			m.DataType = plcDefaultDataType
+		}
+		size := parser.DataTypeSize(m.DataType)
+		if _, err := parser.EncodeValue(0, m.DataType, m.ByteOrder); err != nil {
+			return nil, fmt.Errorf("映射%s: %w", m.MetricCode, err)
+		}
+		sm := modbusServerMap{EModbusMap: m, count: (size + 1) / 2}
+		if m.Address < 0 || sm.end() > 0x10000 {
+			return nil, fmt.Errorf("映射%s的地址%d超出范围", m.MetricCode, m.Address)
+		}
+		s.maps = append(s.maps, sm)
+	}
+	sort.Slice(s.maps, func(i, j int) bool {
+		if s.maps[i].Table != s.maps[j].Table {
+			return s.maps[i].Table < s.maps[j].Table
+		}
+		return s.maps[i].Address < s.maps[j].Address
+	})
+	for i := 1; i < len(s.maps); i++ {
+		prev, cur := s.maps[i-1], s.maps[i]
+		if prev.Table == cur.Table && cur.Address < prev.end() {
+			return nil, fmt.Errorf("映射%s与%s的寄存器重叠", prev.MetricCode, cur.MetricCode)
+		}
+	}
+	return s, nil
+}
+
+// Update 更新测点值，通常在每个轮询周期结束后调用
+func (s *ModbusServer) Update(values map[string]modu.ParseValue) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for code, v := range values {
+		s.values[code] = v
+	}
+}
+
+// mapRegisters 映射当前值的寄存器内容
+func (s *ModbusServer) mapRegisters(m modbusServerMap) []byte {
+	if out, ok := s.valueRegisters(m); ok {
+		return out
+	}
+	// 测点缺失或质量异常
+	out := make([]byte, m.count*2)
+	for i := range out {
+		out[i] = 0xFF
+	}
+	return out
+}
+
+// valueRegisters 按测点当前值编码寄存器，测点缺失、质量异常或无法编码时返回 false
+func (s *ModbusServer) valueRegisters(m modbusServerMap) ([]byte, bool) {
+	v, ok := s.values[m.MetricCode]
+	if !ok || v.Quality != modu.QualityGood && v.Quality != modu.QualityOutOfRange {
+		return nil, false
+	}
+	value := v.Value
+	if m.Scale != 0 {
+		value /= m.Scale
+	}
+	data, err := parser.EncodeValue(value, m.DataType, m.ByteOrder)
+	if err != nil {
+		return nil, false
+	}
+	out := make([]byte, m.count*2)
+	copy(out[len(out)-len(data):], data)
+	return out, true
+}
+
+// registers 读取寄存器表中 [start, start+count) 的内容
+func (s *ModbusServer) registers(table string, start, count int) []byte {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]byte, count*2)
+	for _, m := range s.maps {
+		if m.Table != table || m.end() <= start || m.Address >= start+count {
+			continue
+		}
+		data := s.mapRegisters(m)
+		for i := 0; i < m.count; i++ {
+			if reg := m.Address + i; reg >= start && reg < start+count {
+				copy(out[(reg-start)*2:], data[i*2:i*2+2])
+			}
+		}
+	}
+	return out
+}
+
+// Handle 处理请求 PDU，返回响应 PDU
+func (s *ModbusServer) Handle(pdu []byte) []byte {
+	if len(pdu) == 0 {
+		return nil
+	}
+	fc := pdu[0]
+	exception := func(code byte) []byte { return []byte{fc | 0x80, code} }
+	switch fc {
+	case ModbusReadHoldingRegisters, ModbusReadInputRegisters:
+		if len(pdu) != 5 {
+			return exception(0x03)
+		}
+		start, count := int(binary.BigEndian.Uint16(pdu[1:])), int(binary.BigEndian.Uint16(pdu[3:]))
+		if count < 1 || count > modbusMaxRegisters {
+			return exception(0x03)
+		}
+		if start+count > 0x10000 {
+			return exception(0x02)
+		}
+		table := ModbusTableHolding
+		if fc == ModbusReadInputRegisters {
+			table = ModbusTableInput
+		}
+		data := s.registers(table, start, count)
+		return append([]byte{fc, byte(len(data))}, data...)
+	case ModbusWriteSingleRegister:
+		if len(pdu) != 5 {
+			return exception(0x03)
+		}
+		if code := s.writeRegisters(int(binary.BigEndian.Uint16(pdu[1:])), pdu[3:5]); code != 0 {
+			return exception(code)
+		}
+		return append([]byte(nil), pdu...)
+	case ModbusWriteMultipleRegisters:
+		if len(pdu) < 6 {
+			return exception(0x03)
+		}
+		count := int(binary.BigEndian.Uint16(pdu[3:]))
+		if count < 1 || count > 123 || int(pdu[5]) != count*2 || len(pdu) != 6+count*2 {
+			return exception(0x03)
+		}
+		if code := s.writeRegisters(int(binary.BigEndian.Uint16(pdu[1:])), pdu[6:]); code != 0 {
+			return exception(code)
+		}
+		return append([]byte(nil), pdu[:5]...)
+	}
+	return exception(0x01)
+}
+
+// writeRegisters 将写入的保持寄存器换算为工程值后转发，返回异常码，0 表示成功。
+// 只写入多寄存器映射的一部分时，其余寄存器取当前值
+func (s *ModbusServer) writeRegisters(start int, data []byte) byte {
+	if s.Write == nil {
+		return 0x01
+	}
+	count := len(data) / 2
+	if start+count > 0x10000 {
+		return 0x02
+	}
+	type write struct {
+		hmi   string
+		value float64
+	}
+	var writes []write
+	covered := 0
+	s.mu.RLock()
+	for _, m := range s.maps {
+		if m.Table != ModbusTableHolding || m.end() <= start || m.Address >= start+count {
+			continue
+		}
+		if m.Hmi == "" {
+			s.mu.RUnlock()
+			return 0x02
+		}
+		regs := make([]byte, m.count*2)
+		if m.Address < start || m.end() > start+count {
+			// 只写入多寄存器测点的一部分时，其余寄存器取当前值，当前值无效时无法合成
+			var ok bool
+			if regs, ok = s.valueRegisters(m); !ok {
+				s.mu.RUnlock()
+				return 0x04
+			}
+		}
+		for i := 0; i < m.count; i++ {
+			if reg := m.Address + i; reg >= start && reg < start+count {
+				copy(regs[i*2:], data[(reg-start)*2:(reg-start)*2+2])
+				covered++
+			}
+		}
+		var par parser.HexParser
+		size := parser.DataTypeSize(m.DataType)
+		v, err := par.Parse(regs[len(regs)-size:], nil, modu.EAddr{DataType: m.DataType, ByteOrder: m.ByteOrder, Encoding: parser.EncodingBinary})
+		if err != nil {
+			s.mu.RUnlock()
+			return 0x03
+		}
+		value := v.Value
+		if m.Scale != 0 {
+			value *= m.Scale
+		}
+		writes = append(writes, write{m.Hmi, value})
+	}
+	s.mu.RUnlock()
+	if covered != count {
+		// 写入范围包含未映射的寄存器
+		return 0x02
+	}
+	if s.Check != nil {
+		for _, w := range writes {
+			if err := s.Check(w.hmi, w.value); err != nil {
+				log.Printf("ModbusServer 拒绝写入%s: %v", w.hmi, err)
+				return 0x03
+			}
+		}
+	}
+	for _, w := range writes {
+		if err := s.Write(w.hmi, w.value); err != nil {
+			log.Printf("ModbusServer 转发写入%s失败: %v", w.hmi, err)
+			return 0x04
+		}
+	}
+	return 0
+}
+
+// ListenAndServeTCP 在 address 上监听 Modbus TCP
+func (s *ModbusServer) ListenAndServeTCP(address string) error {
+	ln, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	return s.ServeTCP(ln)
+}
+
+// ServeTCP 接受 Modbus TCP 连接，ln 关闭后返回
+func (s *ModbusServer) ServeTCP(ln net.Listener) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go s.serveConn(conn)
+	}
+}
+
+// serveConn 处理一个 TCP 连接，MBAP 头为 事务号、协议号（0）、长度、单元号
+func (s *ModbusServer) serveConn(conn net.Conn) {
+	defer conn.Close()
+	header := make([]byte, 7)
+	for {
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+		n := int(binary.BigEndian.Uint16(header[4:]))
+		if binary.BigEndian.Uint16(header[2:]) != 0 || n < 2 || n > 254 {
+			return
+		}
+		pdu := make([]byte, n-1)
+		if _, err := io.ReadFull(conn, pdu); err != nil {
+			return
+		}
+		var resp []byte
+		if unit := header[6]; s.SlaveID != 0 && unit != s.SlaveID && unit != 0xFF {
+			resp = []byte{pdu[0] | 0x80, 0x0B}
+		} else {
+			resp = s.Handle(pdu)
+		}
+		frame := make([]byte, 7, 7+len(resp))
+		copy(frame, header[:4])
+		binary.BigEndian.PutUint16(frame[4:], uint16(len(resp)+1))
+		frame[6] = header[6]
+		if _, err := conn.Write(append(frame, resp...)); err != nil {
+			return
+		}
+	}
+}
+
+// modbusRTURequestLen RTU 请求帧长度，数据不足时返回 0，无法判断的功能码返回 -1
+func modbusRTURequestLen(buf []byte) int {
+	if len(buf) < 2 {
+		return 0
+	}
+	switch buf[1] {
+	case ModbusReadCoils, ModbusReadDiscreteInputs, ModbusReadHoldingRegisters, ModbusReadInputRegisters,
+		ModbusWriteSingleCoil, ModbusWriteSingleRegister:
+		return 8
+	case ModbusWriteMultipleCoils, ModbusWriteMultipleRegisters:
+		if len(buf) < 7 {
+			return 0
+		}
+		return 9 + int(buf[6])
+	}
+	return -1
+}
+
+// ServeRTU 在串口上作为 RTU 从站运行，ctx 取消后返回。
+// 帧间隔超过 100 毫秒时丢弃不完整的请求，广播（地址 0）的写入不回复
+func (s *ModbusServer) ServeRTU(ctx context.Context, transport core.Transport) error {
+	if err := transport.Connect(); err != nil {
+		return err
+	}
+	defer transport.Close()
+	var buf []byte
+	for ctx.Err() == nil {
+		readCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		data, err := transport.ReadWithContext(readCtx)
+		cancel()
+		if err != nil {
+			if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+				buf = nil
+				continue
+			}
+			return err
+		}
+		buf = append(buf, data...)
+		for len(buf) > 0 {
+			n := modbusRTURequestLen(buf)
+			if n < 0 {
+				// 不支持的功能码，整帧校验通过时回复异常
+				if body, err := modbusCRC.Verify(buf, 0); err == nil && len(body) >= 2 {
+					s.replyRTU(transport, body[0], []byte{body[1] | 0x80, 0x01})
+					buf = nil
+				}
+				break
+			}
+			if n == 0 || len(buf) < n {
+				break
+			}
+			frame := buf[:n]
+			buf = buf[n:]
+			body, err := modbusCRC.Verify(frame, 0)
+			if err != nil {
+				buf = nil
+				break
+			}
+			slave := body[0]
+			if s.SlaveID != 0 && slave != s.SlaveID && slave != 0 {
+				continue
+			}
+			resp := s.Handle(body[1:])
+			if slave != 0 {
+				s.replyRTU(transport, slave, resp)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *ModbusServer) replyRTU(transport core.Transport, slave byte, pdu []byte) {
+	if err := transport.Write(modbusRTUFramer{}.encode(slave, pdu)); err != nil {
+		log.Printf("ModbusServer RTU 回复失败: %v", err)
+	}
+}
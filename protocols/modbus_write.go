@@ -0,0 +1,131 @@
+package protocols
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/zoneBen/ProtoHub/core"
+	"github.com/zoneBen/ProtoHub/modu"
+	"github.com/zoneBen/ProtoHub/parser"
+)
+
+// Modbus 写入功能码
+const (
+	ModbusWriteSingleCoil        byte = 0x05
+	ModbusWriteSingleRegister    byte = 0x06
+	ModbusWriteMultipleCoils     byte = 0x0F
+	ModbusWriteMultipleRegisters byte = 0x10
+)
+
+// modbusWritePDU 按写屏设定生成写入 PDU：
+// 功能码 5 非零为 ON，功能码 6 写一个寄存器，功能码 16 按数据类型写入一个或多个寄存器
+func modbusWritePDU(hmi modu.EHmi, value float64) ([]byte, error) {
+	if hmi.Address < 0 || hmi.Address > 0xFFFF {
+		return nil, fmt.Errorf("写屏%s地址%d超出范围", hmi.MetricName, hmi.Address)
+	}
+	if hmi.Scale != 0 {
+		value /= hmi.Scale
+	}
+	fc := byte(hmi.FunCode)
+	pdu := []byte{fc, byte(hmi.Address >> 8), byte(hmi.Address)}
+	switch fc {
+	case ModbusWriteSingleCoil:
+		if value != 0 {
+			return append(pdu, 0xFF, 0x00), nil
+		}
+		return append(pdu, 0x00, 0x00), nil
+	case ModbusWriteSingleRegister, ModbusWriteMultipleRegisters:
+		dataType := hmi.DataType
+		if dataType == "" {
+			dataType = plcDefaultDataType
+			if value < 0 {
+				dataType = "INT16"
+			}
+		}
+		data, err := parser.EncodeValue(value, dataType, hmi.ByteOrder)
+		if err != nil {
+			return nil, fmt.Errorf("写屏%s: %w", hmi.MetricName, err)
+		}
+		if len(data)%2 != 0 {
+			data = append([]byte{0}, data...)
+		}
+		if fc == ModbusWriteSingleRegister {
+			if len(data) != 2 {
+				return nil, fmt.Errorf("写屏%s的类型%s不能用功能码6写入", hmi.MetricName, dataType)
+			}
+			return append(pdu, data...), nil
+		}
+		n := len(data) / 2
+		pdu = append(pdu, byte(n>>8), byte(n), byte(len(data)))
+		return append(pdu, data...), nil
+	}
+	return nil, fmt.Errorf("写屏%s不支持功能码%d", hmi.MetricName, hmi.FunCode)
+}
+
+// modbusWrite 发送写入请求并校验响应
+func modbusWrite(transport core.Transport, dev *modu.EParser, hmi modu.EHmi, value float64, framer modbusFramer, timeout time.Duration) error {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return fmt.Errorf("写屏%s的值无效", hmi.MetricName)
+	}
+	pdu, err := modbusWritePDU(hmi, value)
+	if err != nil {
+		return err
+	}
+	slave, err := modbusSlave(dev)
+	if err != nil {
+		return err
+	}
+	resp, err := modbusSend(transport, framer.encode(slave, pdu), framer, timeout)
+	if err != nil {
+		return err
+	}
+	_, rpdu, err := framer.decode(resp)
+	if err != nil {
+		return err
+	}
+	if len(rpdu) >= 2 && rpdu[0] == pdu[0]|0x80 {
+		return &ModbusException{Function: pdu[0], Code: rpdu[1]}
+	}
+	// 单个写入回显请求，多个写入返回起始地址与数量
+	if len(rpdu) < 5 || !bytes.Equal(rpdu[:5], pdu[:5]) {
+		return fmt.Errorf("modbus写入响应%X与请求不符", rpdu)
+	}
+	return nil
+}
+
+// WriteHmi 按写屏设定写入
+func (p *ModbusRTUProtocol) WriteHmi(transport core.Transport, dev *modu.EParser, hmi modu.EHmi, value float64) error {
+	return modbusWrite(transport, dev, hmi, value, modbusRTUFramer{}, modbusTimeout(dev, p.Timeout))
+}
+
+// WriteHmi 按写屏设定写入
+func (p *ModbusASCIIProtocol) WriteHmi(transport core.Transport, dev *modu.EParser, hmi modu.EHmi, value float64) error {
+	return modbusWrite(transport, dev, hmi, value, modbusASCIIFramer{}, modbusTimeout(dev, p.Timeout))
+}
+
+// HmiWriter 按写屏设定名称（EHmi.MetricName）写入设备，供 ModbusServer 转发写入
+func HmiWriter(w core.Writer, transport core.Transport, dev *modu.EParser) func(name string, value float64) error {
+	return func(name string, value float64) error {
+		for _, hmi := range dev.Hmis {
+			if hmi.MetricName == name {
+				return w.WriteHmi(transport, dev, hmi, value)
+			}
+		}
+		return fmt.Errorf("未找到写屏设定%s", name)
+	}
+}
+
+// HmiChecker 检查写屏设定是否存在、写入值能否按 Modbus 写入规则编码，供 ModbusServer 在转发多个写入前统一检查
+func HmiChecker(dev *modu.EParser) func(name string, value float64) error {
+	return func(name string, value float64) error {
+		for _, hmi := range dev.Hmis {
+			if hmi.MetricName == name {
+				_, err := modbusWritePDU(hmi, value)
+				return err
+			}
+		}
+		return fmt.Errorf("未找到写屏设定%s", name)
+	}
+}
@@ -0,0 +1,223 @@
+package protocols
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/zoneBen/ProtoHub/modu"
+	"github.com/zoneBen/ProtoHub/parser"
+)
+
+// plcArea PLC 存储区
+type plcArea struct {
+	Code byte
+	Hex  bool // 地址为十六进制
+	Bit  bool // 位软元件，按字读取时每个字包含 16 个地址
+}
+
+// plcPoint 测点在 PLC 中的位置
+type plcPoint struct {
+	Area    string
+	Address int
+	Words   int
+}
+
+// plcBlock 一次批量读取的连续区域
+type plcBlock struct {
+	Area  string
+	Start int
+	Words int
+}
+
+func (b plcBlock) key() string {
+	return fmt.Sprintf("%s@%d@%d", b.Area, b.Start, b.Words)
+}
+
+const plcDefaultDataType = "UINT16"
+
+func plcDataType(addr modu.EAddr) string {
+	if addr.DataType == "" {
+		return plcDefaultDataType
+	}
+	return addr.DataType
+}
+
+// plcPointSize 测点占用的字节数，未知类型按 Length 个字计算
+func plcPointSize(addr modu.EAddr) int {
+	size := parser.DataTypeSize(plcDataType(addr))
+	if size == 0 {
+		size = 2
+		if addr.Length > 0 {
+			size = addr.Length * 2
+		}
+	}
+	return size
+}
+
+// parsePLCPoint 解析 "D100"、"CIO20" 形式的地址
+func parsePLCPoint(addr modu.EAddr, areas map[string]plcArea) (plcPoint, plcArea, error) {
+	var point plcPoint
+	s := strings.ToUpper(strings.TrimSpace(addr.Command))
+	i := 0
+	for i < len(s) && s[i] >= 'A' && s[i] <= 'Z' {
+		i++
+	}
+	// 十六进制地址的区名可能与数字相连，优先匹配最长的区名
+	for ; i > 0; i-- {
+		if _, ok := areas[s[:i]]; ok {
+			break
+		}
+	}
+	if i == 0 {
+		return point, plcArea{}, fmt.Errorf("unknown plc area in %q", addr.Command)
+	}
+	area := areas[s[:i]]
+	base := 10
+	if area.Hex {
+		base = 16
+	}
+	n, err := strconv.ParseInt(s[i:], base, 32)
+	if err != nil {
+		return point, area, fmt.Errorf("invalid plc address %q", addr.Command)
+	}
+	point.Area = s[:i]
+	point.Address = int(n)
+	point.Words = (plcPointSize(addr) + 1) / 2
+	return point, area, nil
+}
+
+// plcWordOffset 计算地址相对块起始的字偏移
+func plcWordOffset(area plcArea, start, address int) int {
+	if area.Bit {
+		return (address - start) / 16
+	}
+	return address - start
+}
+
+// plcBlocks 将测点按存储区合并为连续读取块，返回测点键到块的映射
+func plcBlocks(dev *modu.EParser, areas map[string]plcArea, maxWords int) map[string]plcBlock {
+	type item struct {
+		point plcPoint
+		area  plcArea
+	}
+	byArea := make(map[string][]item)
+	for _, addr := range dev.Addrs {
+		point, area, err := parsePLCPoint(addr, areas)
+		if err != nil {
+			continue
+		}
+		byArea[point.Area] = append(byArea[point.Area], item{point, area})
+	}
+	blocks := make(map[string]plcBlock)
+	for name, items := range byArea {
+		sort.Slice(items, func(i, j int) bool { return items[i].point.Address < items[j].point.Address })
+		var members []plcPoint
+		var cur plcBlock
+		flush := func() {
+			for _, m := range members {
+				blocks[fmt.Sprintf("%s@%d@%d", m.Area, m.Address, m.Words)] = cur
+			}
+			members = nil
+		}
+		for _, it := range items {
+			end := plcWordOffset(it.area, cur.Start, it.point.Address) + it.point.Words
+			if len(members) > 0 && plcWordOffset(it.area, cur.Start, it.point.Address) <= cur.Words && end <= maxWords {
+				if end > cur.Words {
+					cur.Words = end
+				}
+				members = append(members, it.point)
+				continue
+			}
+			flush()
+			cur = plcBlock{Area: name, Start: it.point.Address, Words: it.point.Words}
+			members = append(members, it.point)
+		}
+		flush()
+	}
+	return blocks
+}
+
+// plcKey 在 plcBlocks 的结果中查找测点所在的读取块，返回命令键
+func plcKey(blocks map[string]plcBlock, addr modu.EAddr, areas map[string]plcArea) string {
+	point, _, err := parsePLCPoint(addr, areas)
+	if err != nil {
+		return ""
+	}
+	block, ok := blocks[fmt.Sprintf("%s@%d@%d", point.Area, point.Address, point.Words)]
+	if !ok {
+		return ""
+	}
+	return block.key()
+}
+
+// plcCommandAddrs 获取命令对应的测点，读取块只计算一次
+func plcCommandAddrs(dev *modu.EParser, areas map[string]plcArea, maxWords int, commandKey string) (addrs []modu.EAddr) {
+	blocks := plcBlocks(dev, areas, maxWords)
+	for _, addr := range dev.Addrs {
+		if plcKey(blocks, addr, areas) == commandKey {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+// plcFailAll PLC 返回结束码等错误时，将命令的全部测点（含展开的位测点）标记为失败
+func plcFailAll(addrs []modu.EAddr, err error) (map[string]modu.ParseValue, error) {
+	if expanded, xerr := parser.ExpandBits(addrs); xerr == nil {
+		addrs = expanded
+	}
+	return parser.FailAll(addrs, modu.QualityExtractFailed, err)
+}
+
+// plcParseWords 按测点的数据类型解析块数据，data 为块起始处的原始字节；
+// 测点未配置字节序时使用 defaultOrder 按数据长度给出的字节序
+func plcParseWords(data []byte, dev *modu.EParser, addrs []modu.EAddr, areas map[string]plcArea, defaultOrder func(size int) string) (map[string]modu.ParseValue, error) {
+	var par parser.HexParser
+	var r = make(map[string]modu.ParseValue)
+	var errs modu.ParseErrors
+	addrs, err := parser.ExpandBits(addrs)
+	if err != nil {
+		return r, err
+	}
+	start := -1
+	for _, addr := range addrs {
+		point, _, err := parsePLCPoint(addr, areas)
+		if err == nil && (start < 0 || point.Address < start) {
+			start = point.Address
+		}
+	}
+	for _, addr := range addrs {
+		v, perr := plcDecode(&par, data, dev, addr, areas, start, defaultOrder)
+		if perr != nil {
+			errs = append(errs, perr)
+		}
+		r[addr.MetricCode] = v
+	}
+	return r, errs.Err()
+}
+
+func plcDecode(par *parser.HexParser, data []byte, dev *modu.EParser, addr modu.EAddr, areas map[string]plcArea, start int, defaultOrder func(size int) string) (modu.ParseValue, *modu.PointError) {
+	point, area, err := parsePLCPoint(addr, areas)
+	if err != nil {
+		return parser.Failed(addr, modu.QualityExtractFailed, err)
+	}
+	off := plcWordOffset(area, start, point.Address) * 2
+	size := plcPointSize(addr)
+	if off < 0 || off+size > len(data) {
+		return parser.Failed(addr, modu.QualityExtractFailed, fmt.Errorf("数据长度不足: 需要%d字节, 实际%d字节", off+size, len(data)))
+	}
+	decodeAddr := addr
+	decodeAddr.DataType = plcDataType(addr)
+	decodeAddr.Encoding = parser.EncodingBinary
+	if decodeAddr.ByteOrder == "" {
+		decodeAddr.ByteOrder = defaultOrder(size)
+	}
+	v, err := par.Parse(data[off:off+size], dev, decodeAddr)
+	if err != nil {
+		return parser.Failed(addr, modu.QualityDecodeFailed, err)
+	}
+	v.Addr = addr
+	return parser.CheckRange(v)
+}
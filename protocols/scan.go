@@ -0,0 +1,354 @@
+package protocols
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/zoneBen/ProtoHub/core"
+)
+
+// Probe 总线扫描时一种协议的探测方式
+type Probe interface {
+	Name() string
+	// AddrRange 可探测的地址范围，协议没有地址时返回 0, 0
+	AddrRange() (min, max int)
+	// Request 生成探测地址 addr 的请求
+	Request(addr int) ([]byte, error)
+	// Check 判断响应是否来自地址 addr 的设备，返回设备信息；响应不完整时返回 ErrIncompleteFrame
+	Check(addr int, resp []byte) (string, error)
+}
+
+var (
+	probesMu sync.RWMutex
+	probes   []Probe
+)
+
+// RegisterProbe 注册探测方式，名称相同时替换
+func RegisterProbe(p Probe) {
+	probesMu.Lock()
+	defer probesMu.Unlock()
+	for i, old := range probes {
+		if old.Name() == p.Name() {
+			probes[i] = p
+			return
+		}
+	}
+	probes = append(probes, p)
+}
+
+// Probes 已注册的探测方式
+func Probes() []Probe {
+	probesMu.RLock()
+	defer probesMu.RUnlock()
+	return append([]Probe(nil), probes...)
+}
+
+func init() {
+	RegisterProbe(&YDTProbe{Ver: 0x21, CID1: 0x40})
+	RegisterProbe(&ModbusProbe{})
+	RegisterProbe(&ModbusProbe{ASCII: true})
+	RegisterProbe(&MegatecProbe{})
+}
+
+// YDTProbe 电总协议探测，发送 CID2=4F 获取协议版本号；
+// 设备以任何 RTN 回复（包括 VER、CID1 错误）均视为在线
+type YDTProbe struct {
+	Ver  byte
+	CID1 byte
+}
+
+func (p *YDTProbe) Name() string              { return "ydt1363" }
+func (p *YDTProbe) AddrRange() (min, max int) { return 0, 254 }
+
+func (p *YDTProbe) Request(addr int) ([]byte, error) {
+	cid2, _ := getByte(YDTGetVersion)
+	return buildFrame(0x7E, p.Ver, byte(addr), p.CID1, cid2, nil, 0x0D)
+}
+
+func (p *YDTProbe) Check(addr int, resp []byte) (string, error) {
+	start := -1
+	for i, b := range resp {
+		if b == 0x7E {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		return "", ErrIncompleteFrame
+	}
+	frame := resp[start:]
+	end := -1
+	for i, b := range frame {
+		if b == 0x0D {
+			end = i
+			break
+		}
+	}
+	if end < 0 {
+		return "", ErrIncompleteFrame
+	}
+	frame = frame[:end+1]
+	if _, err := ydtChecksum.Verify(frame, 1); err != nil {
+		return "", err
+	}
+	if len(frame) < ydtInfoStart+5 {
+		return "", errors.New("电总响应过短")
+	}
+	head, err := hex.DecodeString(string(frame[1:9]))
+	if err != nil {
+		return "", fmt.Errorf("电总响应不是十六进制文本: %w", err)
+	}
+	if int(head[1]) != addr {
+		return "", fmt.Errorf("响应地址%02X与探测地址%02X不符", head[1], addr)
+	}
+	return fmt.Sprintf("VER=%02X CID1=%02X RTN=%02X", head[0], head[2], head[3]), nil
+}
+
+// ModbusProbe Modbus 探测，读取保持寄存器 0；异常响应同样说明设备在线
+type ModbusProbe struct {
+	ASCII bool
+}
+
+func (p *ModbusProbe) framer() modbusFramer {
+	if p.ASCII {
+		return modbusASCIIFramer{}
+	}
+	return modbusRTUFramer{}
+}
+
+func (p *ModbusProbe) Name() string {
+	if p.ASCII {
+		return "modbus-ascii"
+	}
+	return "modbus-rtu"
+}
+
+func (p *ModbusProbe) AddrRange() (min, max int) { return 1, 247 }
+
+func (p *ModbusProbe) Request(addr int) ([]byte, error) {
+	return p.framer().encode(byte(addr), []byte{ModbusReadHoldingRegisters, 0, 0, 0, 1}), nil
+}
+
+func (p *ModbusProbe) Check(addr int, resp []byte) (string, error) {
+	framer := p.framer()
+	n, err := framer.frameLen(resp)
+	if err != nil {
+		return "", err
+	}
+	if n == 0 {
+		return "", ErrIncompleteFrame
+	}
+	slave, pdu, err := framer.decode(resp[:n])
+	if err != nil {
+		return "", err
+	}
+	if int(slave) != addr {
+		return "", fmt.Errorf("响应从站地址%d与探测地址%d不符", slave, addr)
+	}
+	payload, err := modbusPayload(pdu, modbusBlock{Function: ModbusReadHoldingRegisters, Count: 1})
+	var exc *ModbusException
+	if errors.As(err, &exc) {
+		return exc.Error(), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("寄存器0=%d", int(payload[0])<<8|int(payload[1])), nil
+}
+
+// MegatecProbe Megatec UPS 探测，发送 Q1
+type MegatecProbe struct{}
+
+func (p *MegatecProbe) Name() string              { return "megatec" }
+func (p *MegatecProbe) AddrRange() (min, max int) { return 0, 0 }
+
+func (p *MegatecProbe) Request(addr int) ([]byte, error) {
+	return megatecFrame("Q1"), nil
+}
+
+func (p *MegatecProbe) Check(addr int, resp []byte) (string, error) {
+	for i, b := range resp {
+		if b == '\r' {
+			body, err := megatecBody(resp[:i+1], "Q1")
+			if err != nil {
+				return "", err
+			}
+			return body, nil
+		}
+	}
+	return "", ErrIncompleteFrame
+}
+
+// ScanConfig 总线扫描设置。探测按 波特率 × 校验位 × 各协议地址数 依次进行，每次无应答时等待 Timeout，
+// 使用默认值扫描全部已注册协议约需 6×3×750 次探测、一个多小时，应尽量缩小波特率、校验位与地址范围
+type ScanConfig struct {
+	BaudRates []int         // 波特率，默认 9600、19200、4800、2400、38400、115200
+	Parities  []string      // 校验位，默认 N、E、O
+	AddrMin   int           // 最小地址，与各协议的地址范围取交集；与 AddrMax 均为 0 时使用协议的完整范围
+	AddrMax   int           // 最大地址
+	Probes    []Probe       // 探测方式，为空时使用全部已注册的探测方式
+	Timeout   time.Duration // 单次探测的等待时间，默认 300 毫秒
+	// Open 按串口参数创建传输层，如 transport.SerialOpener(transport.SerialConfig{PortName: "/dev/ttyUSB0"})
+	Open func(baudRate int, parity string) (core.Transport, error)
+	// Progress 每完成一次探测回调，done 为已完成次数，total 为总次数
+	Progress func(done, total int)
+}
+
+// ScanResult 一台应答的设备
+type ScanResult struct {
+	Protocol string
+	BaudRate int
+	Parity   string
+	Addr     int
+	Detail   string // 设备信息，如版本号、寄存器值
+	Response []byte
+}
+
+func (r ScanResult) String() string {
+	return fmt.Sprintf("%s %d/%s 地址%d: %s", r.Protocol, r.BaudRate, r.Parity, r.Addr, r.Detail)
+}
+
+// Scan 按波特率、校验位、协议、地址依次探测，found 不为 nil 时每发现一台设备即回调。
+// 同一地址在某一协议下应答后，不再以其他协议探测该串口参数下的该地址。ctx 取消时返回已发现的设备
+func Scan(ctx context.Context, cfg ScanConfig, found func(ScanResult)) ([]ScanResult, error) {
+	if cfg.Open == nil {
+		return nil, errors.New("未设置 ScanConfig.Open")
+	}
+	if len(cfg.BaudRates) == 0 {
+		cfg.BaudRates = []int{9600, 19200, 4800, 2400, 38400, 115200}
+	}
+	if len(cfg.Parities) == 0 {
+		cfg.Parities = []string{"N", "E", "O"}
+	}
+	if len(cfg.Probes) == 0 {
+		cfg.Probes = Probes()
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 300 * time.Millisecond
+	}
+	ranges := make([][2]int, len(cfg.Probes))
+	perSetting := 0
+	for i, probe := range cfg.Probes {
+		ranges[i][0], ranges[i][1] = scanAddrRange(cfg, probe)
+		if ranges[i][1] >= ranges[i][0] {
+			perSetting += ranges[i][1] - ranges[i][0] + 1
+		}
+	}
+	total := perSetting * len(cfg.BaudRates) * len(cfg.Parities)
+	done := 0
+	var results []ScanResult
+	for _, baud := range cfg.BaudRates {
+		for _, parity := range cfg.Parities {
+			if err := ctx.Err(); err != nil {
+				return results, err
+			}
+			transport, err := cfg.Open(baud, parity)
+			if err != nil {
+				return results, err
+			}
+			if err := transport.Connect(); err != nil {
+				transport.Close()
+				return results, fmt.Errorf("打开串口(%d/%s)失败: %w", baud, parity, err)
+			}
+			answered := make(map[int]bool)
+			for i, probe := range cfg.Probes {
+				min, max := ranges[i][0], ranges[i][1]
+				for addr := min; addr <= max && ctx.Err() == nil; addr++ {
+					if max == 0 || !answered[addr] {
+						if r, ok := scanProbe(ctx, transport, probe, addr, cfg.Timeout); ok {
+							r.BaudRate, r.Parity = baud, parity
+							if max > 0 {
+								answered[addr] = true
+							}
+							results = append(results, r)
+							if found != nil {
+								found(r)
+							}
+						}
+					}
+					done++
+					if cfg.Progress != nil {
+						cfg.Progress(done, total)
+					}
+				}
+			}
+			transport.Close()
+		}
+	}
+	return results, ctx.Err()
+}
+
+// scanAddrRange 协议的地址范围与设置的范围取交集
+func scanAddrRange(cfg ScanConfig, probe Probe) (min, max int) {
+	min, max = probe.AddrRange()
+	if (cfg.AddrMin != 0 || cfg.AddrMax != 0) && max > 0 {
+		if cfg.AddrMin > min {
+			min = cfg.AddrMin
+		}
+		if cfg.AddrMax < max {
+			max = cfg.AddrMax
+		}
+	}
+	return min, max
+}
+
+// scanProbe 发送一次探测并等待应答
+func scanProbe(ctx context.Context, transport core.Transport, probe Probe, addr int, timeout time.Duration) (ScanResult, bool) {
+	req, err := probe.Request(addr)
+	if err != nil {
+		return ScanResult{}, false
+	}
+	// 上一次探测迟到的应答不能算作本次的结果
+	scanDiscard(ctx, transport)
+	if err := transport.Write(req); err != nil {
+		log.Printf("扫描%s地址%d发送失败: %v", probe.Name(), addr, err)
+		return ScanResult{}, false
+	}
+	endTime := time.Now().Add(timeout)
+	var received []byte
+	for time.Now().Before(endTime) {
+		readCtx, cancel := context.WithDeadline(ctx, endTime)
+		data, err := transport.ReadWithContext(readCtx)
+		cancel()
+		if err != nil {
+			break
+		}
+		received = append(received, data...)
+		// 依次从每个位置尝试匹配，跳过其他设备的应答与干扰；开头确定不匹配的内容丢弃，
+		// 不完整的部分保留到下次读取
+		drop := 0
+		for off := range received {
+			detail, err := probe.Check(addr, received[off:])
+			if err == nil {
+				return ScanResult{Protocol: probe.Name(), Addr: addr, Detail: detail, Response: received[off:]}, true
+			}
+			if off == drop && !errors.Is(err, ErrIncompleteFrame) {
+				drop = off + 1
+			}
+		}
+		received = received[drop:]
+	}
+	return ScanResult{}, false
+}
+
+// scanDiscard 丢弃尚未读取的输入，传输层支持 ResetInput 时直接清空缓冲区，否则读到短时间内没有数据为止
+func scanDiscard(ctx context.Context, transport core.Transport) {
+	if t, ok := transport.(interface{ ResetInput() error }); ok {
+		if err := t.ResetInput(); err == nil {
+			return
+		}
+	}
+	for i := 0; i < 16; i++ {
+		readCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		data, err := transport.ReadWithContext(readCtx)
+		cancel()
+		if err != nil || len(data) == 0 {
+			return
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package protocols
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -8,6 +9,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/zoneBen/ProtoHub/checksum"
 	"github.com/zoneBen/ProtoHub/core"
 	"github.com/zoneBen/ProtoHub/modu"
 	"github.com/zoneBen/ProtoHub/parser"
@@ -38,6 +40,10 @@ func replacementSpecialCharacters(oldVal string) (val string) {
 // GenerateCommands 生成命令键与内容的映射
 func (p *SimpleTextProtocol) GenerateCommands(dev *modu.EParser) (map[string][]byte, error) {
 	commands := make(map[string][]byte)
+	spec, err := checksum.FromDev(dev.Dev)
+	if err != nil {
+		return nil, err
+	}
 	var sendPre = replacementSpecialCharacters(dev.Dev.SendPre)
 	var sendSuf = replacementSpecialCharacters(dev.Dev.SendSuf)
 	for _, addr := range dev.Addrs {
@@ -48,8 +54,14 @@ func (p *SimpleTextProtocol) GenerateCommands(dev *modu.EParser) (map[string][]b
 			sendSuf = replacementSpecialCharacters(addr.SendSuf)
 		}
 		cmdKey := p.GenerateKey(dev, addr)
-		cmd := fmt.Sprintf("%s%s%s%s%s", sendPre, addr.CID1, addr.Command, addr.CommandExtra, sendSuf)
-		commands[cmdKey] = []byte(cmd)
+		cmd := []byte(fmt.Sprintf("%s%s%s%s", sendPre, addr.CID1, addr.Command, addr.CommandExtra))
+		if spec != nil {
+			// 校验值位于发送后缀之前
+			if cmd, err = spec.Append(cmd); err != nil {
+				return nil, err
+			}
+		}
+		commands[cmdKey] = append(cmd, sendSuf...)
 	}
 	return commands, nil
 }
@@ -76,17 +88,14 @@ func (p *SimpleTextProtocol) Send(transport core.Transport, sendBuf []byte, dev
 		return nil, fmt.Errorf("write failed: %w", err)
 	}
 
-	// 使用配置的接收后缀作为结束标志，默认为 \n
-	var endMarker []byte
-	if dev.Dev.RevSuf != "" {
-		endMarker = []byte(replacementSpecialCharacters(dev.Dev.RevSuf))
-	} else {
-		endMarker = []byte("\n")
-	}
-
 	timeout := 1 * time.Second
+	if dev.Dev.RevTimeout > 0 {
+		timeout = time.Duration(dev.Dev.RevTimeout) * time.Millisecond
+	}
+	idle := time.Duration(dev.Dev.RevIdle) * time.Millisecond
 	endTime := time.Now().Add(timeout)
 	var received []byte
+	var lastData time.Time
 
 	for time.Now().Before(endTime) {
 		remaining := time.Until(endTime)
@@ -96,6 +105,9 @@ func (p *SimpleTextProtocol) Send(transport core.Transport, sendBuf []byte, dev
 
 		// 设置本次读取的最大等待时间（例如 100ms，避免单次阻塞太久）
 		readTimeout := 500 * time.Millisecond
+		if idle > 0 && len(received) > 0 {
+			readTimeout = idle - time.Since(lastData)
+		}
 		if remaining < readTimeout {
 			readTimeout = remaining
 		}
@@ -107,6 +119,10 @@ func (p *SimpleTextProtocol) Send(transport core.Transport, sendBuf []byte, dev
 		if err != nil {
 			// 如果是 context 超时，继续下一轮
 			if errors.Is(err, context.DeadlineExceeded) {
+				// 按空闲间隔结束
+				if idle > 0 && len(received) > 0 && time.Since(lastData) >= idle {
+					return received, nil
+				}
 				continue
 			}
 			// 其他错误（如连接断开）
@@ -115,23 +131,58 @@ func (p *SimpleTextProtocol) Send(transport core.Transport, sendBuf []byte, dev
 
 		if len(data) > 0 {
 			received = append(received, data...)
-			// 检查接收到的数据末尾是否包含完整的结束序列
-			if len(received) >= len(endMarker) {
-				suffix := received[len(received)-len(endMarker):]
-				if equalBytes(suffix, endMarker) {
-					return received, nil
-				}
+			lastData = time.Now()
+			if textResponseComplete(received, dev) {
+				return received, nil
 			}
 		}
 	}
 
-	// 超时但有数据时返回已接收的数据
+	// 超时时返回已接收的数据与错误，由调用方决定是否使用不完整的响应
 	if len(received) > 0 {
-		return received, nil
+		return received, fmt.Errorf("read timeout after %v: incomplete response (%d bytes)", timeout, len(received))
 	}
 	return nil, fmt.Errorf("read timeout after %v", timeout)
 }
 
+// textResponseComplete 判断文本响应是否结束：
+// 配置了 RevLines 时按完整行数，配置了 RevEndLine 时按结束行，
+// 两者都未配置且未配置 RevIdle 时按接收后缀（默认 \n）
+func textResponseComplete(received []byte, dev *modu.EParser) bool {
+	if dev.Dev.RevLines > 0 || dev.Dev.RevEndLine != "" {
+		lines := completeLines(received)
+		if dev.Dev.RevLines > 0 && len(lines) >= dev.Dev.RevLines {
+			return true
+		}
+		if dev.Dev.RevEndLine != "" {
+			for _, line := range lines {
+				if strings.TrimSpace(line) == dev.Dev.RevEndLine {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	if dev.Dev.RevIdle > 0 {
+		return false
+	}
+	// 使用配置的接收后缀作为结束标志，默认为 \n
+	endMarker := []byte("\n")
+	if dev.Dev.RevSuf != "" {
+		endMarker = []byte(replacementSpecialCharacters(dev.Dev.RevSuf))
+	}
+	return len(received) >= len(endMarker) && equalBytes(received[len(received)-len(endMarker):], endMarker)
+}
+
+// completeLines 返回已收到行结束符的非空行
+func completeLines(received []byte) []string {
+	i := strings.LastIndexAny(string(received), "\r\n")
+	if i < 0 {
+		return nil
+	}
+	return parser.TextLines(received[:i+1])
+}
+
 // GetCommandAddrs 获取命令对应的测点
 func (p *SimpleTextProtocol) GetCommandAddrs(dev *modu.EParser, commandKey string) (addrs []modu.EAddr) {
 	for _, addr := range dev.Addrs {
@@ -147,14 +198,34 @@ func (p *SimpleTextProtocol) GetCommandAddrs(dev *modu.EParser, commandKey strin
 func (p *SimpleTextProtocol) ParseResponse(data []byte, dev *modu.EParser, addrs []modu.EAddr) (map[string]modu.ParseValue, error) {
 	var par parser.SimpleParser
 	var r = make(map[string]modu.ParseValue)
+	data, err := verifyTextChecksum(data, dev)
+	if err != nil {
+		return r, err
+	}
+	addrs, err = parser.ExpandBits(addrs)
+	if err != nil {
+		return r, err
+	}
+	var errs modu.ParseErrors
 	for _, addr := range addrs {
-		extract, err := par.Extract(data, dev, addr)
-		if err != nil {
-			log.Printf("提取数据失败")
-			continue
+		v, perr := parser.Decode(&par, data, dev, addr)
+		if perr != nil {
+			errs = append(errs, perr)
 		}
-		v, err := par.Parse(extract, dev, addr)
 		r[addr.MetricCode] = v
 	}
-	return r, nil
+	return r, errs.Err()
+}
+
+// verifyTextChecksum 按设备的校验声明校验响应，校验值位于接收后缀与行结束符之前，返回去掉校验值的内容
+func verifyTextChecksum(data []byte, dev *modu.EParser) ([]byte, error) {
+	spec, err := checksum.FromDev(dev.Dev)
+	if err != nil || spec == nil {
+		return data, err
+	}
+	frame := bytes.TrimRight(data, "\r\n")
+	if suf := replacementSpecialCharacters(dev.Dev.RevSuf); suf != "" {
+		frame = bytes.TrimSuffix(frame, []byte(suf))
+	}
+	return spec.Verify(frame, 0)
 }
@@ -0,0 +1,356 @@
+package protocols
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/zoneBen/ProtoHub/core"
+	"github.com/zoneBen/ProtoHub/modu"
+	"github.com/zoneBen/ProtoHub/parser"
+)
+
+// SNMPProtocol SNMP v1/v2c 采集协议，EAddr.Command 为 OID。
+// EAddr.CommandExtra 为 "WALK" 时按子树遍历，每个实例生成一个测点，
+// MetricCode 以实例索引为后缀；EAddr.Length 可限定遍历的实例数。
+type SNMPProtocol struct {
+	Community      string        // 缺省团体名，EDev.Community 优先
+	MaxOids        int           // 单个 GetRequest 最多携带的 OID 数，默认 10
+	MaxRepetitions int           // GetBulk 的 max-repetitions，默认 10
+	Timeout        time.Duration // 单次请求超时，默认 3 秒
+}
+
+const snmpWalkLimit = 100 // 单次遍历最多发送的请求数
+
+var snmpRequestID uint32
+
+func nextSNMPRequestID() int32 {
+	return int32(atomic.AddUint32(&snmpRequestID, 1) & 0x7FFFFFFF)
+}
+
+func (p *SNMPProtocol) version(dev *modu.EParser) int {
+	switch strings.TrimPrefix(strings.ToLower(dev.Dev.Version), "v") {
+	case "1", "0":
+		return snmpVersion1
+	}
+	return snmpVersion2c
+}
+
+func (p *SNMPProtocol) community(dev *modu.EParser) string {
+	if dev.Dev.Community != "" {
+		return dev.Dev.Community
+	}
+	if p.Community != "" {
+		return p.Community
+	}
+	return "public"
+}
+
+func (p *SNMPProtocol) maxOids() int {
+	if p.MaxOids > 0 {
+		return p.MaxOids
+	}
+	return 10
+}
+
+func (p *SNMPProtocol) maxRepetitions(addr modu.EAddr) int {
+	if addr.Length > 0 && addr.Length < 0x7FFF {
+		return addr.Length
+	}
+	if p.MaxRepetitions > 0 {
+		return p.MaxRepetitions
+	}
+	return 10
+}
+
+func (p *SNMPProtocol) timeout() time.Duration {
+	if p.Timeout > 0 {
+		return p.Timeout
+	}
+	return 3 * time.Second
+}
+
+func isSNMPWalk(addr modu.EAddr) bool {
+	return strings.EqualFold(addr.CommandExtra, "WALK")
+}
+
+func normalizeOID(oid string) string {
+	return strings.Trim(strings.TrimSpace(oid), ".")
+}
+
+// getBatches 按测点顺序将非遍历 OID 分批，返回 OID 对应的批次号
+func (p *SNMPProtocol) getBatches(dev *modu.EParser) (map[string]int, [][]string) {
+	index := make(map[string]int)
+	var batches [][]string
+	for _, addr := range dev.Addrs {
+		if isSNMPWalk(addr) {
+			continue
+		}
+		oid := normalizeOID(addr.Command)
+		if _, ok := index[oid]; ok {
+			continue
+		}
+		if len(batches) == 0 || len(batches[len(batches)-1]) >= p.maxOids() {
+			batches = append(batches, nil)
+		}
+		index[oid] = len(batches) - 1
+		batches[len(batches)-1] = append(batches[len(batches)-1], oid)
+	}
+	return index, batches
+}
+
+// GenerateCommands 生成命令键与内容的映射，普通 OID 合并为 GetRequest，遍历使用 GetBulk（v1 为 GetNext）
+func (p *SNMPProtocol) GenerateCommands(dev *modu.EParser) (map[string][]byte, error) {
+	commands := make(map[string][]byte)
+	version := p.version(dev)
+	community := p.community(dev)
+	_, batches := p.getBatches(dev)
+	for i, oids := range batches {
+		msg := snmpMessage{Version: version, Community: community}
+		msg.PDU = snmpPDU{Type: pduGetRequest, RequestID: nextSNMPRequestID()}
+		for _, oid := range oids {
+			msg.PDU.VarBinds = append(msg.PDU.VarBinds, snmpVarBind{OID: oid, Type: berNull})
+		}
+		buf, err := encodeSNMPMessage(msg)
+		if err != nil {
+			return nil, err
+		}
+		commands[fmt.Sprintf("get@%d", i)] = buf
+	}
+	for _, addr := range dev.Addrs {
+		if !isSNMPWalk(addr) {
+			continue
+		}
+		cmdKey := p.GenerateKey(dev, addr)
+		if _, ok := commands[cmdKey]; ok {
+			continue
+		}
+		buf, err := p.walkRequest(version, community, normalizeOID(addr.Command), p.maxRepetitions(addr))
+		if err != nil {
+			return nil, err
+		}
+		commands[cmdKey] = buf
+	}
+	return commands, nil
+}
+
+func (p *SNMPProtocol) walkRequest(version int, community, oid string, repetitions int) ([]byte, error) {
+	msg := snmpMessage{Version: version, Community: community}
+	msg.PDU = snmpPDU{Type: pduGetBulkRequest, RequestID: nextSNMPRequestID(), ErrorIndex: repetitions}
+	if version == snmpVersion1 {
+		msg.PDU.Type = pduGetNextRequest
+		msg.PDU.ErrorIndex = 0
+	}
+	msg.PDU.VarBinds = []snmpVarBind{{OID: oid, Type: berNull}}
+	return encodeSNMPMessage(msg)
+}
+
+func (p *SNMPProtocol) GenerateKey(dev *modu.EParser, addr modu.EAddr) string {
+	index, _ := p.getBatches(dev)
+	return snmpKey(index, addr)
+}
+
+// snmpKey 由 getBatches 返回的 OID 分批索引生成命令键
+func snmpKey(index map[string]int, addr modu.EAddr) string {
+	oid := normalizeOID(addr.Command)
+	if isSNMPWalk(addr) {
+		return "walk@" + oid
+	}
+	return fmt.Sprintf("get@%d", index[oid])
+}
+
+// Send 发送请求；遍历请求会持续发送后续请求直到离开子树，返回拼接的全部响应报文
+func (p *SNMPProtocol) Send(transport core.Transport, sendBuf []byte, dev *modu.EParser) ([]byte, error) {
+	req, _, err := decodeSNMPMessage(sendBuf)
+	if err != nil {
+		return nil, fmt.Errorf("invalid snmp request: %w", err)
+	}
+	err = transport.Connect()
+	if err != nil {
+		log.Println("SNMPProtocol Send connect err:", err)
+		return nil, err
+	}
+	defer transport.Close()
+
+	if req.PDU.Type != pduGetBulkRequest && req.PDU.Type != pduGetNextRequest {
+		return p.exchange(transport, sendBuf, req.PDU.RequestID)
+	}
+
+	root := req.PDU.VarBinds[0].OID
+	var received []byte
+	buf := sendBuf
+	for i := 0; i < snmpWalkLimit; i++ {
+		resp, err := p.exchange(transport, buf, req.PDU.RequestID)
+		if err != nil {
+			if len(received) > 0 {
+				return received, nil
+			}
+			return nil, err
+		}
+		msg, _, err := decodeSNMPMessage(resp)
+		if err == nil && msg.PDU.ErrorStatus != 0 && len(received) > 0 {
+			// v1 遍历越过 MIB 末尾时以 noSuchName 结束，丢弃该响应以保留已取得的结果
+			break
+		}
+		received = append(received, resp...)
+		if err != nil || msg.PDU.ErrorStatus != 0 || len(msg.PDU.VarBinds) == 0 {
+			break
+		}
+		last := msg.PDU.VarBinds[len(msg.PDU.VarBinds)-1]
+		if last.Type == berEndOfMibView || !strings.HasPrefix(last.OID, root+".") {
+			break
+		}
+		req.PDU.RequestID = nextSNMPRequestID()
+		req.PDU.VarBinds = []snmpVarBind{{OID: last.OID, Type: berNull}}
+		buf, err = encodeSNMPMessage(req)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return received, nil
+}
+
+// exchange 发送单个请求并等待 request-id 匹配的响应
+func (p *SNMPProtocol) exchange(transport core.Transport, sendBuf []byte, requestID int32) ([]byte, error) {
+	err := transport.Write(sendBuf)
+	if err != nil {
+		return nil, fmt.Errorf("write failed: %w", err)
+	}
+	endTime := time.Now().Add(p.timeout())
+	for time.Now().Before(endTime) {
+		ctx, cancel := context.WithDeadline(context.Background(), endTime)
+		data, err := transport.ReadWithContext(ctx)
+		cancel()
+		if err != nil {
+			if errors.Is(err, context.DeadlineExceeded) {
+				break
+			}
+			return nil, fmt.Errorf("read error: %w", err)
+		}
+		msg, _, err := decodeSNMPMessage(data)
+		if err != nil || msg.PDU.Type != pduGetResponse || msg.PDU.RequestID != requestID {
+			// 丢弃无法解析或过期的响应
+			continue
+		}
+		return data, nil
+	}
+	return nil, fmt.Errorf("snmp timeout after %v", p.timeout())
+}
+
+// GetCommandAddrs 获取命令对应的测点
+func (p *SNMPProtocol) GetCommandAddrs(dev *modu.EParser, commandKey string) (addrs []modu.EAddr) {
+	index, _ := p.getBatches(dev)
+	for _, addr := range dev.Addrs {
+		if snmpKey(index, addr) == commandKey {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+// ParseResponse 解析响应数据，data 可以包含多个连续的响应报文
+func (p *SNMPProtocol) ParseResponse(data []byte, dev *modu.EParser, addrs []modu.EAddr) (map[string]modu.ParseValue, error) {
+	var r = make(map[string]modu.ParseValue)
+	var vbs []snmpVarBind
+	for len(data) > 0 {
+		msg, rest, err := decodeSNMPMessage(data)
+		if err != nil {
+			return parser.FailAll(addrs, modu.QualityExtractFailed, err)
+		}
+		if msg.PDU.ErrorStatus != 0 {
+			return parser.FailAll(addrs, modu.QualityExtractFailed,
+				fmt.Errorf("snmp error-status %d at index %d", msg.PDU.ErrorStatus, msg.PDU.ErrorIndex))
+		}
+		vbs = append(vbs, msg.PDU.VarBinds...)
+		data = rest
+	}
+	var errs modu.ParseErrors
+	collect := func(v modu.ParseValue, perr *modu.PointError) {
+		if perr != nil {
+			errs = append(errs, perr)
+		}
+		r[v.Addr.MetricCode] = v
+	}
+	for _, addr := range addrs {
+		oid := normalizeOID(addr.Command)
+		if !isSNMPWalk(addr) {
+			found := false
+			for _, vb := range vbs {
+				if vb.OID == oid {
+					collect(snmpDecode(vb, addr))
+					found = true
+					break
+				}
+			}
+			if !found {
+				collect(parser.Failed(addr, modu.QualityExtractFailed, errors.New("响应中没有该OID")))
+			}
+			continue
+		}
+		count := 0
+		for _, vb := range vbs {
+			if !strings.HasPrefix(vb.OID, oid+".") {
+				continue
+			}
+			if addr.Length > 0 && count >= addr.Length {
+				break
+			}
+			suffix := strings.TrimPrefix(vb.OID, oid+".")
+			inst := addr
+			inst.Command = vb.OID
+			inst.MetricCode = addr.MetricCode + "_" + strings.Replace(suffix, ".", "_", -1)
+			if _, ok := r[inst.MetricCode]; ok {
+				continue
+			}
+			collect(snmpDecode(vb, inst))
+			count++
+		}
+		if count == 0 {
+			collect(parser.Failed(addr, modu.QualityExtractFailed, errors.New("子树下没有实例")))
+		}
+	}
+	return r, errs.Err()
+}
+
+// snmpDecode 转换变量绑定并标记质量，noSuch* 与 endOfMibView 视为提取失败
+func snmpDecode(vb snmpVarBind, addr modu.EAddr) (modu.ParseValue, *modu.PointError) {
+	switch vb.Type {
+	case berNoSuchObject, berNoSuchInst, berEndOfMibView:
+		return parser.Failed(addr, modu.QualityExtractFailed, errors.New(snmpTypeName(vb.Type)))
+	}
+	v, err := snmpParseValue(vb, addr)
+	if err != nil {
+		return parser.Failed(addr, modu.QualityDecodeFailed, err)
+	}
+	return parser.CheckRange(v)
+}
+
+// snmpParseValue 将变量绑定转换为测点值，OCTET STRING 优先按 ReMap 映射
+func snmpParseValue(vb snmpVarBind, addr modu.EAddr) (modu.ParseValue, error) {
+	var parseValue modu.ParseValue
+	parseValue.Addr = addr
+	var v float64
+	var err error
+	if vb.Type == berOctetString && parser.IsTypedType(addr.DataType) {
+		return parser.DecodeTyped(vb.Value, addr)
+	}
+	if vb.Type == berOctetString && (addr.ReMap != "" || addr.DataType == "MAP") {
+		item, err := parser.MapText(addr, string(vb.Value))
+		if err != nil {
+			return parseValue, err
+		}
+		v = item.Value
+		parseValue.Label, parseValue.Severity = item.Label, item.Severity
+	} else {
+		v, err = vb.Float()
+		if err != nil {
+			return parseValue, err
+		}
+	}
+	parseValue.Value = applyScale(v, addr)
+	return parser.ApplyEnum(parseValue)
+}
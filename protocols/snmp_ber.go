@@ -0,0 +1,422 @@
+package protocols
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// SNMP 用到的 BER 标签
+const (
+	berInteger      = 0x02
+	berOctetString  = 0x04
+	berNull         = 0x05
+	berOID          = 0x06
+	berSequence     = 0x30
+	berIPAddress    = 0x40
+	berCounter32    = 0x41
+	berGauge32      = 0x42
+	berTimeTicks    = 0x43
+	berOpaque       = 0x44
+	berCounter64    = 0x46
+	berNoSuchObject = 0x80
+	berNoSuchInst   = 0x81
+	berEndOfMibView = 0x82
+
+	pduGetRequest     = 0xA0
+	pduGetNextRequest = 0xA1
+	pduGetResponse    = 0xA2
+	pduSetRequest     = 0xA3
+	pduTrapV1         = 0xA4
+	pduGetBulkRequest = 0xA5
+	pduInformRequest  = 0xA6
+	pduTrapV2         = 0xA7
+	pduReport         = 0xA8
+)
+
+const (
+	snmpVersion1  = 0
+	snmpVersion2c = 1
+)
+
+type snmpVarBind struct {
+	OID   string
+	Type  byte
+	Value []byte // 值的原始内容（不含标签和长度）
+}
+
+type snmpPDU struct {
+	Type        byte
+	RequestID   int32
+	ErrorStatus int // GetBulk 时为 non-repeaters
+	ErrorIndex  int // GetBulk 时为 max-repetitions
+	VarBinds    []snmpVarBind
+
+	// 仅 SNMPv1 Trap 使用
+	Enterprise   string
+	AgentAddr    net.IP
+	GenericTrap  int
+	SpecificTrap int
+	Timestamp    uint32
+}
+
+type snmpMessage struct {
+	Version   int
+	Community string
+	PDU       snmpPDU
+}
+
+// ---------- 编码 ----------
+
+func berLength(n int) []byte {
+	if n < 0x80 {
+		return []byte{byte(n)}
+	}
+	var b []byte
+	for n > 0 {
+		b = append([]byte{byte(n)}, b...)
+		n >>= 8
+	}
+	return append([]byte{0x80 | byte(len(b))}, b...)
+}
+
+func berTLV(tag byte, content []byte) []byte {
+	out := []byte{tag}
+	out = append(out, berLength(len(content))...)
+	return append(out, content...)
+}
+
+func berEncodeInteger(v int64) []byte {
+	var b []byte
+	for {
+		b = append([]byte{byte(v)}, b...)
+		// 剩余部分只剩符号扩展时结束
+		if (v < 128 && v >= -128) || len(b) == 8 {
+			break
+		}
+		v >>= 8
+	}
+	return berTLV(berInteger, b)
+}
+
+func berEncodeOID(oid string) ([]byte, error) {
+	parts := strings.Split(strings.Trim(oid, "."), ".")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("invalid oid %q", oid)
+	}
+	nums := make([]uint64, len(parts))
+	for i, s := range parts {
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid oid %q: %w", oid, err)
+		}
+		nums[i] = n
+	}
+	if nums[0] > 2 || (nums[0] < 2 && nums[1] >= 40) {
+		return nil, fmt.Errorf("invalid oid %q", oid)
+	}
+	content := berBase128(nums[0]*40 + nums[1])
+	for _, n := range nums[2:] {
+		content = append(content, berBase128(n)...)
+	}
+	return berTLV(berOID, content), nil
+}
+
+func berBase128(n uint64) []byte {
+	b := []byte{byte(n & 0x7F)}
+	n >>= 7
+	for n > 0 {
+		b = append([]byte{byte(n&0x7F) | 0x80}, b...)
+		n >>= 7
+	}
+	return b
+}
+
+func encodeSNMPMessage(msg snmpMessage) ([]byte, error) {
+	var vbs []byte
+	for _, vb := range msg.PDU.VarBinds {
+		oid, err := berEncodeOID(vb.OID)
+		if err != nil {
+			return nil, err
+		}
+		tag := vb.Type
+		if tag == 0 {
+			tag = berNull
+		}
+		vbs = append(vbs, berTLV(berSequence, append(oid, berTLV(tag, vb.Value)...))...)
+	}
+	var pdu []byte
+	pdu = append(pdu, berEncodeInteger(int64(msg.PDU.RequestID))...)
+	pdu = append(pdu, berEncodeInteger(int64(msg.PDU.ErrorStatus))...)
+	pdu = append(pdu, berEncodeInteger(int64(msg.PDU.ErrorIndex))...)
+	pdu = append(pdu, berTLV(berSequence, vbs)...)
+
+	var body []byte
+	body = append(body, berEncodeInteger(int64(msg.Version))...)
+	body = append(body, berTLV(berOctetString, []byte(msg.Community))...)
+	body = append(body, berTLV(msg.PDU.Type, pdu)...)
+	return berTLV(berSequence, body), nil
+}
+
+// ---------- 解码 ----------
+
+// berRead 读取一个 TLV，返回标签、内容以及剩余数据
+func berRead(data []byte) (tag byte, content []byte, rest []byte, err error) {
+	if len(data) < 2 {
+		return 0, nil, nil, errors.New("ber: data too short")
+	}
+	tag = data[0]
+	l := int(data[1])
+	pos := 2
+	if l&0x80 != 0 {
+		n := l & 0x7F
+		if n == 0 || n > 4 || len(data) < pos+n {
+			return 0, nil, nil, errors.New("ber: invalid length")
+		}
+		l = 0
+		for i := 0; i < n; i++ {
+			l = l<<8 | int(data[pos+i])
+		}
+		pos += n
+	}
+	if l < 0 || len(data) < pos+l {
+		return 0, nil, nil, fmt.Errorf("ber: need %d bytes, have %d", pos+l, len(data))
+	}
+	return tag, data[pos : pos+l], data[pos+l:], nil
+}
+
+func berExpect(data []byte, want byte) (content []byte, rest []byte, err error) {
+	tag, content, rest, err := berRead(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if tag != want {
+		return nil, nil, fmt.Errorf("ber: expect tag 0x%02X, got 0x%02X", want, tag)
+	}
+	return content, rest, nil
+}
+
+func berDecodeInteger(b []byte) int64 {
+	if len(b) == 0 {
+		return 0
+	}
+	v := int64(int8(b[0]))
+	for _, c := range b[1:] {
+		v = v<<8 | int64(c)
+	}
+	return v
+}
+
+func berDecodeUnsigned(b []byte) uint64 {
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+func berDecodeOID(b []byte) (string, error) {
+	if len(b) == 0 {
+		return "", errors.New("ber: empty oid")
+	}
+	var nums []uint64
+	var n uint64
+	for i, c := range b {
+		n = n<<7 | uint64(c&0x7F)
+		if c&0x80 == 0 {
+			if len(nums) == 0 {
+				first := n / 40
+				if first > 2 {
+					first = 2
+				}
+				nums = append(nums, first, n-first*40)
+			} else {
+				nums = append(nums, n)
+			}
+			n = 0
+		} else if i == len(b)-1 {
+			return "", errors.New("ber: truncated oid")
+		}
+	}
+	parts := make([]string, len(nums))
+	for i, v := range nums {
+		parts[i] = strconv.FormatUint(v, 10)
+	}
+	return strings.Join(parts, "."), nil
+}
+
+func decodeSNMPMessage(data []byte) (msg snmpMessage, rest []byte, err error) {
+	body, rest, err := berExpect(data, berSequence)
+	if err != nil {
+		return msg, nil, err
+	}
+	content, body, err := berExpect(body, berInteger)
+	if err != nil {
+		return msg, nil, err
+	}
+	msg.Version = int(berDecodeInteger(content))
+	content, body, err = berExpect(body, berOctetString)
+	if err != nil {
+		return msg, nil, err
+	}
+	msg.Community = string(content)
+	tag, pdu, _, err := berRead(body)
+	if err != nil {
+		return msg, nil, err
+	}
+	msg.PDU.Type = tag
+	if tag == pduTrapV1 {
+		err = decodeTrapV1PDU(pdu, &msg.PDU)
+	} else {
+		err = decodeGenericPDU(pdu, &msg.PDU)
+	}
+	return msg, rest, err
+}
+
+func decodeGenericPDU(data []byte, pdu *snmpPDU) error {
+	var vals [3]int64
+	for i := range vals {
+		content, rest, err := berExpect(data, berInteger)
+		if err != nil {
+			return err
+		}
+		vals[i] = berDecodeInteger(content)
+		data = rest
+	}
+	pdu.RequestID = int32(vals[0])
+	pdu.ErrorStatus = int(vals[1])
+	pdu.ErrorIndex = int(vals[2])
+	vbs, err := decodeVarBinds(data)
+	pdu.VarBinds = vbs
+	return err
+}
+
+func decodeTrapV1PDU(data []byte, pdu *snmpPDU) error {
+	content, data, err := berExpect(data, berOID)
+	if err != nil {
+		return err
+	}
+	if pdu.Enterprise, err = berDecodeOID(content); err != nil {
+		return err
+	}
+	if content, data, err = berExpect(data, berIPAddress); err != nil {
+		return err
+	}
+	if len(content) == 4 {
+		pdu.AgentAddr = net.IP(append([]byte(nil), content...))
+	}
+	if content, data, err = berExpect(data, berInteger); err != nil {
+		return err
+	}
+	pdu.GenericTrap = int(berDecodeInteger(content))
+	if content, data, err = berExpect(data, berInteger); err != nil {
+		return err
+	}
+	pdu.SpecificTrap = int(berDecodeInteger(content))
+	if content, data, err = berExpect(data, berTimeTicks); err != nil {
+		return err
+	}
+	pdu.Timestamp = uint32(berDecodeUnsigned(content))
+	pdu.VarBinds, err = decodeVarBinds(data)
+	return err
+}
+
+func decodeVarBinds(data []byte) ([]snmpVarBind, error) {
+	list, _, err := berExpect(data, berSequence)
+	if err != nil {
+		return nil, err
+	}
+	var vbs []snmpVarBind
+	for len(list) > 0 {
+		var item []byte
+		item, list, err = berExpect(list, berSequence)
+		if err != nil {
+			return vbs, err
+		}
+		content, item, err := berExpect(item, berOID)
+		if err != nil {
+			return vbs, err
+		}
+		oid, err := berDecodeOID(content)
+		if err != nil {
+			return vbs, err
+		}
+		tag, value, _, err := berRead(item)
+		if err != nil {
+			return vbs, err
+		}
+		vbs = append(vbs, snmpVarBind{OID: oid, Type: tag, Value: value})
+	}
+	return vbs, nil
+}
+
+// ---------- 值转换 ----------
+
+// Float 将数值类变量绑定转换为 float64
+func (vb snmpVarBind) Float() (float64, error) {
+	switch vb.Type {
+	case berInteger:
+		return float64(berDecodeInteger(vb.Value)), nil
+	case berCounter32, berGauge32, berTimeTicks, berCounter64:
+		return float64(berDecodeUnsigned(vb.Value)), nil
+	case berOctetString, berOpaque:
+		return strconv.ParseFloat(strings.TrimSpace(string(vb.Value)), 64)
+	case berNoSuchObject, berNoSuchInst, berEndOfMibView:
+		return 0, fmt.Errorf("snmp %s: %s", vb.OID, snmpTypeName(vb.Type))
+	default:
+		return 0, fmt.Errorf("snmp %s: unsupported type %s", vb.OID, snmpTypeName(vb.Type))
+	}
+}
+
+// String 返回变量绑定的文本表示
+func (vb snmpVarBind) String() string {
+	switch vb.Type {
+	case berOctetString, berOpaque:
+		return string(vb.Value)
+	case berOID:
+		s, _ := berDecodeOID(vb.Value)
+		return s
+	case berIPAddress:
+		return net.IP(vb.Value).String()
+	case berInteger:
+		return strconv.FormatInt(berDecodeInteger(vb.Value), 10)
+	case berCounter32, berGauge32, berTimeTicks, berCounter64:
+		return strconv.FormatUint(berDecodeUnsigned(vb.Value), 10)
+	default:
+		return snmpTypeName(vb.Type)
+	}
+}
+
+func snmpTypeName(t byte) string {
+	switch t {
+	case berInteger:
+		return "INTEGER"
+	case berOctetString:
+		return "OCTET STRING"
+	case berNull:
+		return "NULL"
+	case berOID:
+		return "OBJECT IDENTIFIER"
+	case berIPAddress:
+		return "IpAddress"
+	case berCounter32:
+		return "Counter32"
+	case berGauge32:
+		return "Gauge32"
+	case berTimeTicks:
+		return "TimeTicks"
+	case berOpaque:
+		return "Opaque"
+	case berCounter64:
+		return "Counter64"
+	case berNoSuchObject:
+		return "noSuchObject"
+	case berNoSuchInst:
+		return "noSuchInstance"
+	case berEndOfMibView:
+		return "endOfMibView"
+	}
+	return fmt.Sprintf("0x%02X", t)
+}
@@ -0,0 +1,189 @@
+package protocols
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zoneBen/ProtoHub/alarm"
+	"github.com/zoneBen/ProtoHub/modu"
+)
+
+const (
+	snmpTrapOIDVar     = "1.3.6.1.6.3.1.1.4.1.0" // snmpTrapOID.0
+	snmpGenericTrapOID = "1.3.6.1.6.3.1.1.5"     // 标准 Trap 前缀（RFC 3584）
+)
+
+// TrapReceiver SNMP v1/v2c Trap 接收器，按来源 IP 找到设备后用 EParser.Traps 规则匹配，
+// 产生与轮询路径相同的 modu.AlarmEvent
+type TrapReceiver struct {
+	Address   string                   // 监听地址，默认 ":162"
+	Community string                   // 非空时只接收该团体名的 Trap
+	Devices   map[string]*modu.EParser // 来源 IP -> 设备
+	Handler   func(modu.AlarmEvent)    // 告警回调
+
+	mu     sync.Mutex
+	conn   net.PacketConn
+	closed bool
+}
+
+// ListenAndServe 开始监听，直到 Close 被调用
+func (t *TrapReceiver) ListenAndServe() error {
+	address := t.Address
+	if address == "" {
+		address = ":162"
+	}
+	conn, err := net.ListenPacket("udp", address)
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	if t.closed {
+		// Close 在监听建立前已被调用
+		t.mu.Unlock()
+		return conn.Close()
+	}
+	t.conn = conn
+	t.mu.Unlock()
+
+	buf := make([]byte, 65535)
+	for {
+		n, remote, err := conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		data := append([]byte(nil), buf[:n]...)
+		if err := t.handle(conn, data, remote); err != nil {
+			log.Printf("TrapReceiver %s: %v", remote, err)
+		}
+	}
+}
+
+// Close 停止监听
+func (t *TrapReceiver) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed = true
+	if t.conn == nil {
+		return nil
+	}
+	err := t.conn.Close()
+	t.conn = nil
+	return err
+}
+
+func (t *TrapReceiver) handle(conn net.PacketConn, data []byte, remote net.Addr) error {
+	msg, _, err := decodeSNMPMessage(data)
+	if err != nil {
+		return err
+	}
+	if t.Community != "" && msg.Community != t.Community {
+		return fmt.Errorf("community mismatch: %q", msg.Community)
+	}
+	switch msg.PDU.Type {
+	case pduTrapV1, pduTrapV2:
+	case pduInformRequest:
+		// Inform 需要回复同 request-id 的 Response
+		ack := msg
+		ack.PDU.Type = pduGetResponse
+		ack.PDU.ErrorStatus, ack.PDU.ErrorIndex = 0, 0
+		if buf, err := encodeSNMPMessage(ack); err == nil {
+			conn.WriteTo(buf, remote)
+		}
+	default:
+		return fmt.Errorf("unexpected pdu 0x%02X", msg.PDU.Type)
+	}
+
+	ip := remote.String()
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+	dev, ok := t.Devices[ip]
+	if !ok && msg.PDU.AgentAddr != nil {
+		dev, ok = t.Devices[msg.PDU.AgentAddr.String()]
+	}
+	if !ok {
+		return fmt.Errorf("no device configured for %s", ip)
+	}
+	if t.Handler == nil {
+		return nil
+	}
+	for _, event := range matchTrap(dev, msg, ip) {
+		t.Handler(event)
+	}
+	return nil
+}
+
+// trapOID 返回 Trap 的标识 OID，v1 Trap 按 RFC 3584 转换
+func trapOID(msg snmpMessage) string {
+	if msg.PDU.Type == pduTrapV1 {
+		if msg.PDU.GenericTrap == 6 {
+			return fmt.Sprintf("%s.0.%d", msg.PDU.Enterprise, msg.PDU.SpecificTrap)
+		}
+		return fmt.Sprintf("%s.%d", snmpGenericTrapOID, msg.PDU.GenericTrap+1)
+	}
+	for _, vb := range msg.PDU.VarBinds {
+		if vb.OID == snmpTrapOIDVar && vb.Type == berOID {
+			return vb.String()
+		}
+	}
+	return ""
+}
+
+// matchTrap 用设备的 Trap 规则匹配一条 Trap 报文
+func matchTrap(dev *modu.EParser, msg snmpMessage, remote string) []modu.AlarmEvent {
+	var events []modu.AlarmEvent
+	oid := trapOID(msg)
+	now := time.Now()
+	for _, rule := range dev.Traps {
+		if rule.TrapOid != "" && normalizeOID(rule.TrapOid) != oid {
+			continue
+		}
+		value := 1.0
+		if rule.VarOid != "" {
+			varOid := normalizeOID(rule.VarOid)
+			found := false
+			for _, vb := range msg.PDU.VarBinds {
+				if vb.OID != varOid && !strings.HasPrefix(vb.OID, varOid+".") {
+					continue
+				}
+				if rule.Operator == "" {
+					found = true
+					break
+				}
+				v, err := vb.Float()
+				if err != nil {
+					continue
+				}
+				if alarm.Compare(rule.Operator, v, rule.Value) {
+					value = v
+					found = true
+					break
+				}
+			}
+			if !found {
+				continue
+			}
+		} else if rule.TrapOid == "" {
+			// 既无 Trap OID 也无变量的规则不匹配任何 Trap
+			continue
+		}
+		events = append(events, modu.AlarmEvent{
+			Device:     dev.Dev.Name,
+			MetricName: rule.MetricName,
+			Value:      value,
+			AlarmCont:  rule.AlarmCont,
+			Source:     alarm.SourceTrap,
+			Remote:     remote,
+			Time:       now,
+		})
+	}
+	return events
+}
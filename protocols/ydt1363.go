@@ -0,0 +1,306 @@
+package protocols
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/zoneBen/ProtoHub/modu"
+)
+
+// YD/T 1363 标准 CID2 命令
+const (
+	YDTGetAnalog       = "41" // 获取模拟量量化后数据（浮点数）
+	YDTGetSwitch       = "43" // 获取开关输入状态
+	YDTGetAlarm        = "44" // 获取告警状态
+	YDTGetTime         = "4D" // 获取监测模块时间
+	YDTGetVersion      = "4F" // 获取通信协议版本号
+	YDTGetAddress      = "50" // 获取设备地址
+	YDTGetManufacturer = "51" // 获取厂家信息
+)
+
+// 响应帧中 INFO 的起始位置：SOI(1) VER(2) ADR(2) CID1(2) RTN(2) LENGTH(4)
+const ydtInfoStart = 13
+
+// ydtField 模板字段，按顺序排列在 INFO 中
+type ydtField struct {
+	Code     string
+	Name     string
+	Unit     string
+	DataType string // UINT8 或 FLOAT32
+}
+
+// ydtCommand 一条命令的响应模板，Repeat 紧跟在 Fields 之后，按 CountCode 字段重复
+type ydtCommand struct {
+	Command string
+	Fields  []ydtField
+	Repeat  *ydtRepeat
+}
+
+// ydtRepeat 数量字段之后的重复块
+type ydtRepeat struct {
+	CountCode string
+	Fields    []ydtField
+}
+
+// ydtPreset 一类设备的命令模板
+type ydtPreset struct {
+	Name     string
+	Cid1     string
+	Commands []ydtCommand
+}
+
+func ydtDataFlag() ydtField {
+	return ydtField{"dataflag", "DATAFLAG", "", "UINT8"}
+}
+
+// ydt1363Presets 按 YD/T 1363.3 整理的常用设备模板，Fields 为 INFO 开头的固定部分，
+// Repeat 为数量字段之后的重复块；更深的嵌套结构由测点表自行补充。
+// CID1 取标准中的设备类型编码：40H 交流配电、41H 整流模块、42H 直流配电、2AH UPS、60H 空调，
+// 而不是常被误记的 "40H UPS、42H 整流"，以便 Preset 为 auto 时能按设备实际上报的 CID1 匹配。
+var ydt1363Presets = []ydtPreset{
+	{
+		Name: "ac", Cid1: "40", // 交流配电
+		Commands: []ydtCommand{
+			{YDTGetAnalog, []ydtField{ydtDataFlag(),
+				{"screen_count", "交流屏数量", "", "UINT8"},
+				{"input_count", "输入路数", "", "UINT8"},
+				{"input_va", "输入A相电压", "V", "FLOAT32"},
+				{"input_vb", "输入B相电压", "V", "FLOAT32"},
+				{"input_vc", "输入C相电压", "V", "FLOAT32"},
+				{"input_freq", "输入频率", "Hz", "FLOAT32"},
+			}, nil},
+			{YDTGetAlarm, []ydtField{ydtDataFlag(),
+				{"screen_count", "交流屏数量", "", "UINT8"},
+				{"input_count", "输入路数", "", "UINT8"},
+				{"input_va_alarm", "输入A相电压告警", "", "UINT8"},
+				{"input_vb_alarm", "输入B相电压告警", "", "UINT8"},
+				{"input_vc_alarm", "输入C相电压告警", "", "UINT8"},
+				{"input_freq_alarm", "输入频率告警", "", "UINT8"},
+			}, nil},
+		},
+	},
+	{
+		Name: "rectifier", Cid1: "41", // 整流模块
+		Commands: []ydtCommand{
+			{YDTGetAnalog, []ydtField{ydtDataFlag(),
+				{"output_voltage", "输出电压", "V", "FLOAT32"},
+				{"module_count", "模块数量", "", "UINT8"},
+			}, &ydtRepeat{"module_count", []ydtField{
+				{"module_current", "模块输出电流", "A", "FLOAT32"},
+			}}},
+			{YDTGetSwitch, []ydtField{ydtDataFlag(),
+				{"module_count", "模块数量", "", "UINT8"},
+			}, &ydtRepeat{"module_count", []ydtField{
+				{"module_onoff", "模块开/关机状态", "", "UINT8"},
+				{"module_limit", "模块限流/不限流状态", "", "UINT8"},
+				{"module_charge", "模块浮充/均充状态", "", "UINT8"},
+			}}},
+			{YDTGetAlarm, []ydtField{ydtDataFlag(),
+				{"module_count", "模块数量", "", "UINT8"},
+			}, &ydtRepeat{"module_count", []ydtField{
+				{"module_fault", "模块故障状态", "", "UINT8"},
+			}}},
+		},
+	},
+	{
+		Name: "dc", Cid1: "42", // 直流配电
+		Commands: []ydtCommand{
+			{YDTGetAnalog, []ydtField{ydtDataFlag(),
+				{"screen_count", "直流屏数量", "", "UINT8"},
+				{"output_voltage", "直流输出电压", "V", "FLOAT32"},
+				{"load_current", "总负载电流", "A", "FLOAT32"},
+				{"battery_count", "电池组数", "", "UINT8"},
+			}, &ydtRepeat{"battery_count", []ydtField{
+				{"battery_current", "电池组充放电电流", "A", "FLOAT32"},
+			}}},
+			{YDTGetAlarm, []ydtField{ydtDataFlag(),
+				{"screen_count", "直流屏数量", "", "UINT8"},
+				{"voltage_alarm", "直流电压告警", "", "UINT8"},
+			}, nil},
+		},
+	},
+	{
+		Name: "aircon", Cid1: "60", // 空调
+		Commands: []ydtCommand{
+			{YDTGetAnalog, []ydtField{ydtDataFlag(),
+				{"aircon_count", "空调数量", "", "UINT8"},
+			}, &ydtRepeat{"aircon_count", []ydtField{
+				{"return_temp", "回风温度", "℃", "FLOAT32"},
+				{"return_humidity", "回风湿度", "%", "FLOAT32"},
+			}}},
+			{YDTGetSwitch, []ydtField{ydtDataFlag(),
+				{"aircon_count", "空调数量", "", "UINT8"},
+			}, &ydtRepeat{"aircon_count", []ydtField{
+				{"aircon_onoff", "空调开/关机状态", "", "UINT8"},
+			}}},
+			{YDTGetAlarm, []ydtField{ydtDataFlag(),
+				{"aircon_count", "空调数量", "", "UINT8"},
+			}, &ydtRepeat{"aircon_count", []ydtField{
+				{"aircon_fault", "空调故障", "", "UINT8"},
+			}}},
+		},
+	},
+	{
+		Name: "ups", Cid1: "2A", // UPS
+		Commands: []ydtCommand{
+			{YDTGetAnalog, []ydtField{ydtDataFlag(),
+				{"input_va", "输入A相电压", "V", "FLOAT32"},
+				{"input_vb", "输入B相电压", "V", "FLOAT32"},
+				{"input_vc", "输入C相电压", "V", "FLOAT32"},
+				{"input_freq", "输入频率", "Hz", "FLOAT32"},
+				{"output_va", "输出A相电压", "V", "FLOAT32"},
+				{"output_vb", "输出B相电压", "V", "FLOAT32"},
+				{"output_vc", "输出C相电压", "V", "FLOAT32"},
+				{"output_ia", "输出A相电流", "A", "FLOAT32"},
+				{"output_ib", "输出B相电流", "A", "FLOAT32"},
+				{"output_ic", "输出C相电流", "A", "FLOAT32"},
+				{"output_freq", "输出频率", "Hz", "FLOAT32"},
+				{"load_a", "A相负载率", "%", "FLOAT32"},
+				{"load_b", "B相负载率", "%", "FLOAT32"},
+				{"load_c", "C相负载率", "%", "FLOAT32"},
+				{"battery_voltage", "电池电压", "V", "FLOAT32"},
+				{"battery_capacity", "电池剩余容量", "%", "FLOAT32"},
+				{"backup_time", "电池后备时间", "min", "FLOAT32"},
+			}, nil},
+			{YDTGetSwitch, []ydtField{ydtDataFlag()}, nil},
+			{YDTGetAlarm, []ydtField{ydtDataFlag()}, nil},
+		},
+	},
+}
+
+// ydtCommonAddrs 各类设备通用的命令模板
+func ydtCommonAddrs() []modu.EAddr {
+	return []modu.EAddr{
+		// 协议版本号与设备地址取自响应帧头的 VER、ADR
+		{Command: YDTGetVersion, MetricCode: "protocol_version", MetricName: "通信协议版本号", StartAt: 1, Length: 2, DataType: "UINT8", ByteOrder: "AB"},
+		{Command: YDTGetAddress, MetricCode: "device_address", MetricName: "设备地址", StartAt: 3, Length: 2, DataType: "UINT8", ByteOrder: "AB"},
+	}
+}
+
+// ydtInfoAddrs 监测模块时间与厂家信息，并非所有设备都支持，Preset 带 "+info" 时展开
+func ydtInfoAddrs() []modu.EAddr {
+	return []modu.EAddr{
+		{Command: YDTGetTime, MetricCode: "device_time", MetricName: "监测模块时间", StartAt: ydtInfoStart, Length: 14, DataType: "YDTTIME"},
+		// 厂家信息：设备名称(10) 软件版本(2) 厂家名称(20)
+		{Command: YDTGetManufacturer, MetricCode: "device_name", MetricName: "设备名称", StartAt: ydtInfoStart, Length: 20, DataType: "GBK"},
+		{Command: YDTGetManufacturer, MetricCode: "software_version_major", MetricName: "厂家软件主版本", StartAt: ydtInfoStart + 20, Length: 2, DataType: "UINT8", ByteOrder: "AB"},
+		{Command: YDTGetManufacturer, MetricCode: "software_version_minor", MetricName: "厂家软件次版本", StartAt: ydtInfoStart + 22, Length: 2, DataType: "UINT8", ByteOrder: "AB"},
+		{Command: YDTGetManufacturer, MetricCode: "manufacturer", MetricName: "厂家名称", StartAt: ydtInfoStart + 24, Length: 40, DataType: "GBK"},
+	}
+}
+
+// findYDTPreset 按名称或 CID1 查找模板，name 为 "auto" 或 "YDT1363" 时按设备 CID1 查找
+func findYDTPreset(name, cid1 string) (ydtPreset, bool) {
+	name = strings.TrimSpace(name)
+	auto := strings.EqualFold(name, "auto") || strings.EqualFold(name, "YDT1363")
+	for _, preset := range ydt1363Presets {
+		if auto && strings.EqualFold(preset.Cid1, cid1) {
+			return preset, true
+		}
+		if strings.EqualFold(preset.Name, name) || strings.EqualFold(preset.Cid1, name) {
+			return preset, true
+		}
+	}
+	return ydtPreset{}, false
+}
+
+// ydtFieldAddrs 按字段顺序计算起始位，一个字节占两个 ASCII 字符，返回测点与总长度
+func ydtFieldAddrs(cid1, command string, fields []ydtField, start int) ([]modu.EAddr, int) {
+	var addrs []modu.EAddr
+	total := 0
+	for _, f := range fields {
+		length := 2
+		addr := modu.EAddr{
+			CID1:       cid1,
+			Command:    command,
+			MetricCode: ydtMetricCode(command, f.Code),
+			MetricName: f.Name,
+			MetricUnit: f.Unit,
+			StartAt:    start + total,
+			DataType:   f.DataType,
+			ByteOrder:  "AB",
+		}
+		if f.DataType == "FLOAT32" {
+			// YD/T 1363.3 浮点数低字节在前
+			length = 8
+			addr.ByteOrder = "DCBA"
+		}
+		addr.Length = length
+		addrs = append(addrs, addr)
+		total += length
+	}
+	return addrs, total
+}
+
+func ydtMetricCode(command, code string) string {
+	return fmt.Sprintf("%s_%s", strings.ToLower(command), code)
+}
+
+// expandYDTCommand 展开一条命令的测点，重复块生成紧跟固定部分的重复结构
+func expandYDTCommand(cid1 string, cmd ydtCommand) ([]modu.EAddr, []modu.EGroup) {
+	addrs, length := ydtFieldAddrs(cid1, cmd.Command, cmd.Fields, ydtInfoStart)
+	if cmd.Repeat == nil {
+		return addrs, nil
+	}
+	members, stride := ydtFieldAddrs(cid1, cmd.Command, cmd.Repeat.Fields, 0)
+	group := modu.EGroup{
+		Name:     ydtMetricCode(cmd.Command, cmd.Repeat.CountCode) + "_group",
+		StartAt:  ydtInfoStart + length,
+		CountRef: ydtMetricCode(cmd.Command, cmd.Repeat.CountCode),
+		Stride:   stride,
+	}
+	for i := range members {
+		members[i].Group = group.Name
+	}
+	return append(addrs, members...), []modu.EGroup{group}
+}
+
+// ExpandPreset 按 EDev.Preset 将 YD/T 1363 内置命令模板展开到 dev.Addrs，
+// 已存在同名 MetricCode 的测点保持不变，可在测点表中覆盖模板。
+// Preset 写作 "ups+info" 时同时展开监测模块时间（4DH）与厂家信息（51H）。
+func (p *ACProtocol) ExpandPreset(dev *modu.EParser) error {
+	if dev.Dev.Preset == "" {
+		return nil
+	}
+	parts := strings.SplitN(dev.Dev.Preset, "+", 2)
+	preset, ok := findYDTPreset(parts[0], dev.Dev.Cid1)
+	if !ok {
+		return fmt.Errorf("未找到YD/T 1363模板: %s", dev.Dev.Preset)
+	}
+	exists := make(map[string]bool)
+	for _, addr := range dev.Addrs {
+		exists[addr.MetricCode] = true
+	}
+	addrs := ydtCommonAddrs()
+	if len(parts) == 2 {
+		if !strings.EqualFold(strings.TrimSpace(parts[1]), "info") {
+			return fmt.Errorf("不支持的YD/T 1363模板选项: %s", parts[1])
+		}
+		addrs = append(addrs, ydtInfoAddrs()...)
+	}
+	for i := range addrs {
+		addrs[i].CID1 = preset.Cid1
+	}
+	groupExists := make(map[string]bool)
+	for _, g := range dev.Groups {
+		groupExists[g.Name] = true
+	}
+	for _, cmd := range preset.Commands {
+		cmdAddrs, groups := expandYDTCommand(preset.Cid1, cmd)
+		addrs = append(addrs, cmdAddrs...)
+		for _, g := range groups {
+			if !groupExists[g.Name] {
+				groupExists[g.Name] = true
+				dev.Groups = append(dev.Groups, g)
+			}
+		}
+	}
+	for _, addr := range addrs {
+		if exists[addr.MetricCode] {
+			continue
+		}
+		exists[addr.MetricCode] = true
+		dev.Addrs = append(dev.Addrs, addr)
+	}
+	return nil
+}
@@ -8,6 +8,8 @@ import (
 	"sync"
 
 	serial "github.com/albenik/go-serial/v2"
+
+	"github.com/zoneBen/ProtoHub/core"
 )
 
 // SerialConfig 串口配置
@@ -55,6 +57,16 @@ func NewSerialTransport(config *SerialConfig) *SerialTransport {
 	return &SerialTransport{config: config}
 }
 
+// SerialOpener 以 base 为模板按波特率、校验位创建串口传输层，用于 protocols.ScanConfig.Open
+func SerialOpener(base SerialConfig) func(baudRate int, parity string) (core.Transport, error) {
+	return func(baudRate int, parity string) (core.Transport, error) {
+		config := base
+		config.BaudRate = baudRate
+		config.Parity = parity
+		return NewSerialTransport(&config), nil
+	}
+}
+
 // Connect 打开串口并配置参数
 func (s *SerialTransport) Connect() error {
 	s.mu.Lock()
@@ -206,6 +218,20 @@ func (s *SerialTransport) ReadWithContext(ctx context.Context) ([]byte, error) {
 	}
 }
 
+// ResetInput 丢弃串口输入缓冲区中尚未读取的数据
+func (s *SerialTransport) ResetInput() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.port == nil {
+		return ErrNotConnected
+	}
+	if p, ok := s.port.(interface{ ResetInputBuffer() error }); ok {
+		return p.ResetInputBuffer()
+	}
+	return nil
+}
+
 func (s *SerialTransport) isClosed() bool {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -0,0 +1,96 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+)
+
+type UDPConfig struct {
+	Address string
+	Timeout time.Duration
+}
+
+// UDPTransport UDP 传输层，每次 Read 返回一个完整数据报
+type UDPTransport struct {
+	config *UDPConfig
+	conn   net.Conn
+}
+
+func NewUDPTransport(config *UDPConfig) *UDPTransport {
+	if config.Timeout == 0 {
+		config.Timeout = 3 * time.Second
+	}
+	return &UDPTransport{config: config}
+}
+
+func (u *UDPTransport) Connect() error {
+	conn, err := net.DialTimeout("udp", u.config.Address, u.config.Timeout)
+	if err != nil {
+		return err
+	}
+	u.conn = conn
+	return nil
+}
+
+func (u *UDPTransport) Write(data []byte) error {
+	if u.conn == nil {
+		return errors.New("udp connection not established")
+	}
+	_, err := u.conn.Write(data)
+	return err
+}
+
+func (u *UDPTransport) Read() ([]byte, error) {
+	if u.conn == nil {
+		return nil, errors.New("udp connection not established")
+	}
+	if err := u.conn.SetReadDeadline(time.Now().Add(u.config.Timeout)); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 65535)
+	n, err := u.conn.Read(buf)
+	if err != nil {
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			return nil, errors.New("read timeout")
+		}
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+func (u *UDPTransport) ReadWithContext(ctx context.Context) ([]byte, error) {
+	if u.conn == nil {
+		return nil, errors.New("udp connection not established")
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(u.config.Timeout)
+	}
+	if err := u.conn.SetReadDeadline(deadline); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 65535)
+	n, err := u.conn.Read(buf)
+	if err != nil {
+		if netErr, isNet := err.(net.Error); isNet && netErr.Timeout() {
+			// 截止时间来自 context 时，按 context 超时返回，便于调用方区分
+			if ok {
+				return nil, context.DeadlineExceeded
+			}
+			return nil, errors.New("read timeout")
+		}
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+func (u *UDPTransport) Close() error {
+	if u.conn == nil {
+		return nil
+	}
+	err := u.conn.Close()
+	u.conn = nil
+	return err
+}